@@ -0,0 +1,41 @@
+package main
+
+import (
+	"path/filepath"
+
+	"github.com/sdotz/apple-news-push-api/pkg/api"
+)
+
+//The audit log file, or "" when --auditLog none turned it off
+func auditLogPath() string {
+	switch *auditLog {
+	case "":
+		return filepath.Join(*stateDir, "audit.jsonl")
+	case "none":
+		return ""
+	default:
+		return *auditLog
+	}
+}
+
+//The sinks the audit flags ask for, or nil when every one is turned off
+func auditSinks() api.AuditSink {
+	var sinks api.AuditSinks
+	if path := auditLogPath(); len(path) > 0 {
+		sinks = append(sinks, api.NewAuditLog(path))
+	}
+	if *auditSyslog {
+		sink, err := api.NewSyslogAuditSink("anews")
+		if err != nil {
+			errorAndDie(err)
+		}
+		sinks = append(sinks, sink)
+	}
+	if len(*auditWebhook) > 0 {
+		sinks = append(sinks, api.NewWebhookAuditSink(*auditWebhook))
+	}
+	if len(sinks) == 0 {
+		return nil
+	}
+	return sinks
+}
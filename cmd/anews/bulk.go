@@ -0,0 +1,61 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/sdotz/apple-news-push-api/pkg/api"
+)
+
+type bulkReport struct {
+	Matched   int              `json:"matched"`
+	Succeeded int              `json:"succeeded"`
+	Failed    int              `json:"failed"`
+	Results   []api.BulkResult `json:"results"`
+}
+
+func requireNoArticleId(articleID string) {
+	if len(articleID) > 0 {
+		errorAndDie(fmt.Errorf("give either an article ID or --where conditions, not both"))
+	}
+}
+
+//Finds the articles matching the --where conditions and lists them, then once confirmed applies fn to each, at most
+//concurrency at a time. Prints a report of what happened to each article and exits with 1 if any failed
+func bulkApply(c *api.Client, where []string, action string, yes bool, dryRun bool, concurrency int, fn func(api.SearchArticle) error) {
+	filter, err := api.ParseArticleFilter(where)
+	if err != nil {
+		errorAndDie(err)
+	}
+	articles, err := c.FindArticles(filter)
+	if err != nil {
+		errorAndDie(err)
+	}
+
+	for _, article := range articles {
+		fmt.Fprintf(os.Stderr, "%s  %s  %-10s  %s\n", article.ID, article.CreatedAt.Format("2006-01-02 15:04"), article.State, article.Title)
+	}
+	fmt.Fprintf(os.Stderr, "%d articles matched\n", len(articles))
+	if dryRun || len(articles) == 0 {
+		printResponse(bulkReport{Matched: len(articles), Results: []api.BulkResult{}})
+	}
+	if !yes && !confirm(fmt.Sprintf("%s these %d articles?", action, len(articles))) {
+		errorAndDie(fmt.Errorf("aborted"))
+	}
+
+	report := bulkReport{Matched: len(articles), Results: api.BulkApply(articles, concurrency, fn)}
+	for _, result := range report.Results {
+		if len(result.Error) > 0 {
+			report.Failed++
+		} else {
+			report.Succeeded++
+		}
+	}
+	if report.Failed == 0 {
+		printResponse(report)
+	}
+	j, _ := json.Marshal(report)
+	fmt.Println(string(j))
+	errorAndDie(fmt.Errorf("%s failed for %d of %d articles", action, report.Failed, report.Matched))
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/sdotz/apple-news-push-api/pkg/api"
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+func newContentTypeOptions(cmd *kingpin.CmdClause) *map[string]string {
+	return cmd.Flag("contentType", "Upload bundle files with this extension or path as this content type, e.g. .woff=font/woff. Can be repeated").StringMap()
+}
+
+//Opens the bundle directory or archive, warning on stderr about files in it that won't be uploaded
+func openBundle(path string, contentTypes map[string]string) *api.Bundle {
+	bundle, err := api.OpenBundle(path)
+	if err != nil {
+		errorAndDie(err)
+	}
+	bundle.ContentTypes = make(map[string]api.ContentType)
+	for name, contentType := range contentTypes {
+		bundle.ContentTypes[name] = api.ContentType(contentType)
+	}
+	bundle.FontDir = *fontDir
+	scan, err := bundle.Scan()
+	if err != nil {
+		errorAndDie(err)
+	}
+	for _, problem := range scan.FontProblems {
+		fmt.Fprintf(os.Stderr, "Warning: %s\n", problem)
+	}
+	for _, name := range scan.Unused {
+		fmt.Fprintf(os.Stderr, "Warning: %s isn't referenced by article.json and won't be uploaded\n", name)
+	}
+	return bundle
+}
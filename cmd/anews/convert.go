@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/sdotz/apple-news-push-api/pkg/anf"
+)
+
+type conversionResult struct {
+	BundlePath string      `json:"bundlePath"`
+	Assets     []anf.Asset `json:"assets"`
+	Dropped    []string    `json:"dropped"`
+}
+
+func convertMarkdown(path string, out string, options anf.MarkdownOptions) {
+	markdown, err := ioutil.ReadFile(path)
+	if err != nil {
+		errorAndDie(err)
+	}
+	conversion, err := anf.ConvertMarkdown(markdown, options)
+	if err == anf.ErrMissingTitle {
+		errorAndDie(fmt.Errorf("%s, pass --title to give one", err))
+	}
+	if err != nil {
+		errorAndDie(err)
+	}
+	writeConversion(conversion, path, out)
+}
+
+func convertHtml(path string, out string, options anf.HtmlOptions) {
+	f, err := os.Open(path)
+	if err != nil {
+		errorAndDie(err)
+	}
+	defer f.Close()
+
+	conversion, err := anf.ConvertHtml(f, options)
+	if err != nil {
+		errorAndDie(err)
+	}
+	writeConversion(conversion, path, out)
+}
+
+//Writes the bundle, warns about anything that was dropped on stderr, and prints a summary
+func writeConversion(conversion *anf.Conversion, sourcePath string, out string) {
+	if len(out) == 0 {
+		out = strings.TrimSuffix(sourcePath, filepath.Ext(sourcePath))
+	}
+	if err := conversion.WriteBundle(out); err != nil {
+		errorAndDie(err)
+	}
+	for _, d := range conversion.Dropped {
+		fmt.Fprintf(os.Stderr, "Warning: dropped %s\n", d)
+	}
+	printResponse(conversionResult{
+		BundlePath: out,
+		Assets:     conversion.Assets,
+		Dropped:    conversion.Dropped,
+	})
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/sdotz/apple-news-push-api/pkg/api"
+)
+
+func softDeletions(c *api.Client) *api.SoftDeletions {
+	return api.NewSoftDeletions(c, filepath.Join(*stateDir, "soft_deletions.json"), *operator)
+}
+
+//Shows the article's title and deletes it once confirmed, saving a backup first unless --no-backup. With --soft it
+//is only hidden until `purge` runs after the grace period
+func deleteArticle(c *api.Client, articleID string) {
+	article, err := c.ReadArticle(articleID)
+	if err != nil {
+		errorAndDie(err)
+	}
+	action := "Delete"
+	if *deleteSoft {
+		action = fmt.Sprintf("Hide, and delete after %s,", *deleteGrace)
+	}
+	fmt.Fprintf(os.Stderr, "%s article %s %q (revision %s)?\n", action, articleID, article.Data.Title, article.Data.Revision)
+	if !*deleteYes && !confirm("Continue?") {
+		errorAndDie(fmt.Errorf("aborted"))
+	}
+
+	entry, err := removeArticle(c, softDeletions(c), articleID)
+	if err != nil {
+		errorAndDie(err)
+	}
+	if entry != nil {
+		printResponse(entry)
+	}
+}
+
+//Backs up the article unless --no-backup, then deletes it, or with --soft hides it in soft until the grace period is
+//over. Returns the soft deletion, if it was one. Calls running at the same time must share soft, whose lock keeps
+//them from overwriting each other's entries
+func removeArticle(c *api.Client, soft *api.SoftDeletions, articleID string) (*api.SoftDeletion, error) {
+	if *deleteBackup {
+		dir := *deleteBackupDir
+		if len(dir) == 0 {
+			dir = filepath.Join(*stateDir, "backups")
+		}
+		backup, err := c.BackupArticle(articleID, dir)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't back up article %s, so it wasn't deleted: %s", articleID, err)
+		}
+		fmt.Fprintf(os.Stderr, "Saved a backup to %s\n", backup.Dir)
+		for _, problem := range backup.AssetErrors {
+			fmt.Fprintf(os.Stderr, "Warning: the backup of %s keeps the API's URL for an asset that couldn't be downloaded: %s\n", articleID, problem)
+		}
+	}
+
+	if *deleteSoft {
+		return soft.Delete(articleID, *deleteGrace)
+	}
+	return nil, c.DeleteArticle(articleID)
+}
+
+//Runs a single purge, or keeps purging every interval when it is greater than zero
+func purgeArticles(s *api.SoftDeletions, every time.Duration) {
+	if every <= 0 {
+		results, err := s.Tick(s.Client.Now())
+		if err != nil {
+			errorAndDie(err)
+		}
+		printResponse(results)
+	}
+
+	err := s.Run(context.Background(), every, func(results []api.PurgeResult, err error) {
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			return
+		}
+		if len(results) > 0 {
+			j, _ := json.Marshal(results)
+			fmt.Println(string(j))
+		}
+	})
+	if err != nil {
+		errorAndDie(err)
+	}
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"net/http"
+	"path/filepath"
+
+	"github.com/sdotz/apple-news-push-api/pkg/anf"
+	"github.com/sdotz/apple-news-push-api/pkg/api"
+	"github.com/sdotz/apple-news-push-api/pkg/ingest"
+)
+
+func ingestFeed(c *api.Client, source string, bundleDir string, rulesPath string, metadata api.Metadata, dryRun bool) {
+	feed, err := ingest.LoadFeed(source, &http.Client{})
+	if err != nil {
+		errorAndDie(err)
+	}
+	rules, err := loadSectionRules(rulesPath)
+	if err != nil {
+		errorAndDie(err)
+	}
+
+	feedDir := filepath.Join(*stateDir, "ingest", anf.Slug(source))
+	if len(bundleDir) == 0 {
+		bundleDir = filepath.Join(feedDir, "bundles")
+	}
+	baseDir, baseURL := "", ""
+	if isURL(source) {
+		baseURL = source
+	} else {
+		baseDir = filepath.Dir(source)
+	}
+
+	ingester := &ingest.Ingester{
+		Client:       c,
+		StatePath:    filepath.Join(feedDir, "state.json"),
+		BundleDir:    bundleDir,
+		Metadata:     metadata,
+		SectionRules: rules,
+		BaseDir:      baseDir,
+		BaseURL:      baseURL,
+		DryRun:       dryRun,
+	}
+	results, err := ingester.Ingest(feed)
+	if err != nil {
+		errorAndDie(err)
+	}
+	printResponse(results)
+}
@@ -3,24 +3,37 @@ package main
 import (
 	"encoding/json"
 	"fmt"
+	"log/slog"
 	"net/http"
 	"os"
 	"time"
 
-	"bytes"
-	"io/ioutil"
 	"path/filepath"
+	"strings"
 
+	"github.com/sdotz/apple-news-push-api/pkg/anf"
 	"github.com/sdotz/apple-news-push-api/pkg/api"
 	"gopkg.in/alecthomas/kingpin.v2"
 )
 
 var (
-	//verbose   = kingpin.Flag("verbose", "Verbose mode.").Short('v').Bool()
-	channelId = kingpin.Flag("channelId", "The ID of the channel to use").Default(os.Getenv("CHANNEL_ID")).String()
-	apiKey    = kingpin.Flag("apiKey", "The API key to use when calling the API").Default(os.Getenv("APPLE_NEWS_API_KEY")).String()
-	apiSecret = kingpin.Flag("apiSecret", "The API secret to use when calling the API").Default(os.Getenv("APPLE_NEWS_API_SECRET")).String()
-	baseUrl   = kingpin.Flag("baseUrl", "The base URL to use for API calls").Default(api.DefaultAppleNewsBaseURL).String()
+	verbose           = kingpin.Flag("verbose", "Log every API request to stderr. Repeat (-vv) to include full request and response bodies").Short('v').Counter()
+	channelId         = kingpin.Flag("channelId", "The ID of the channel to use").Default(os.Getenv("CHANNEL_ID")).String()
+	apiKey            = kingpin.Flag("apiKey", "The API key to use when calling the API").Default(os.Getenv("APPLE_NEWS_API_KEY")).String()
+	apiSecret         = kingpin.Flag("apiSecret", "The API secret to use when calling the API").Default(os.Getenv("APPLE_NEWS_API_SECRET")).String()
+	baseUrl           = kingpin.Flag("baseUrl", "The base URL to use for API calls").Default(api.DefaultAppleNewsBaseURL).String()
+	stateDir          = kingpin.Flag("stateDir", "Directory where local state such as the notification log is kept").Default(defaultStateDir()).String()
+	operator          = kingpin.Flag("operator", "The name recorded as the operator of any changes made").Default(os.Getenv("USER")).String()
+	fontDir           = kingpin.Flag("fontDir", "Directory with custom fonts to upload along with bundles whose text styles use them").Default(os.Getenv("ANEWS_FONT_DIR")).String()
+	processImages     = kingpin.Flag("processImages", "Scale down, recompress and strip metadata from bundle images before uploading them").Bool()
+	maxImageDimension = kingpin.Flag("maxImageDimension", "With --processImages, the longest side images are scaled down to").Default(fmt.Sprint(api.DefaultMaxImageDimension)).Int()
+	jpegQuality       = kingpin.Flag("jpegQuality", "With --processImages, the quality JPEGs are recompressed at").Default(fmt.Sprint(api.DefaultJpegQuality)).Int()
+	cacheTTL          = kingpin.Flag("cacheTTL", "Cache channel and section info in the state directory for this long, e.g. 1h. Disabled by default").Duration()
+	auditLog          = kingpin.Flag("auditLog", "Append an entry for every change made to the channel to this JSON lines file. Defaults to audit.jsonl in the state directory, none turns it off").String()
+	auditSyslog       = kingpin.Flag("auditSyslog", "Send an entry for every change made to the channel to the local syslog").Bool()
+	auditWebhook      = kingpin.Flag("auditWebhook", "Post an entry for every change made to the channel to this URL as JSON").String()
+	correctClockSkew  = kingpin.Flag("correctClockSkew", "When the API refuses a request and its clock differs from ours, learn the difference and sign with the corrected time").Default("true").Bool()
+	metricsListen     = kingpin.Flag("metricsListen", "Serve Prometheus metrics about API calls at /metrics on this address, e.g. while running promote tick --every").String()
 
 	readCommand = kingpin.Command("read", "Read a channel, section or article")
 	articleId   = readCommand.Command("article", "Read an article").Arg("Article ID", "The (apple) ID of the article to read").String()
@@ -29,33 +42,134 @@ var (
 
 	listChannelSections = kingpin.Command("list", "List sections")
 
+	cacheCommand      = kingpin.Command("cache", "Manage the channel and section cache")
+	cacheClearCommand = cacheCommand.Command("clear", "Drop all cached channel and section info")
+
 	searchCommand  = kingpin.Command("search", "List articles in a channel or section")
 	searchOptions  = newSearchOptions(searchCommand)
 	searchFromDate = searchCommand.Flag("fromDate", "Start paging from this date (formatted like 2006-01-02)").String()
 	searchToDate   = searchCommand.Flag("toDate", "End paging at this date (formatted like 2006-01-02)").String()
 
 	createCommand = kingpin.Command("create", "Create an article")
-	bundlePath    = createCommand.Arg("bundlePath", "Path to the bundle directory. It should contain article.json and any images that are referenced within it").Required().ExistingDir()
+	bundlePath    = createCommand.Arg("bundlePath", "Path to the bundle directory, or a .zip, .tar.gz or .tgz archive of one. It should contain article.json and any images that are referenced within it").Required().ExistingFileOrDir()
 	createOptions = newCreateUpdateOptions(createCommand)
+	createRules   = newSectionRuleOptions(createCommand)
+	createTypes   = newContentTypeOptions(createCommand)
 
 	updateCommand    = kingpin.Command("update", "Update an article")
-	updateBundlePath = updateCommand.Flag("bundlePath", "Path to the bundle. It should contain article.json and any images that are referenced within it").ExistingFileOrDir()
+	updateBundlePath = updateCommand.Flag("bundlePath", "Path to the bundle directory, or a .zip, .tar.gz or .tgz archive of one. It should contain article.json and any images that are referenced within it").ExistingFileOrDir()
 	revision         = updateCommand.Arg("revision ID", "The revision ID of the article to update").Required().String()
 	updateArticleId  = updateCommand.Arg("article ID", "The (apple) ID of the article to update").Required().String()
 	updateOptions    = newCreateUpdateOptions(updateCommand)
-
-	promoteCommand    = kingpin.Command("promote", "Promote an article")
-	promoteSectionId  = promoteCommand.Arg("section ID", "The section ID to promote articles in").Required().String()
-	promoteArticleIds = promoteCommand.Arg("article IDs", "The article IDs to promote. If none, then promoted articles will be removed").Strings()
-
-	deleteCommand   = kingpin.Command("delete", "Delete an article")
-	deleteArticleId = deleteCommand.Arg("article ID", "The ID of the article to delete").Required().String()
-
-	pushCommand           = kingpin.Command("push", "Send a push notification")
-	notificationArticleId = pushCommand.Arg("articleId", "The apple ID of the article to send the notification to").Required().String()
-	alertBody             = pushCommand.Arg("alertBody", "The body of the push notification to send").Required().String()
-	countries             = pushCommand.Flag("countries", "The countries to send the push notificstion to").HintOptions(api.CountryEU, api.CountryGB, api.CountryUS).Enums(api.CountryEU, api.CountryGB, api.CountryUS)
-	ignoreWarnings        = pushCommand.Flag("ignoreWarnings", "Ignore warnings about alert length. (Best practice is <= 130 characters, and anything > 500 chars will be truncated.)").Bool()
+	updateRules      = newSectionRuleOptions(updateCommand)
+	updateTypes      = newContentTypeOptions(updateCommand)
+
+	promoteCommand    = kingpin.Command("promote", "Manage the promoted articles of a section")
+	promoteYes        = promoteCommand.Flag("yes", "Apply changes without asking for confirmation").Short('y').Bool()
+	promoteDryRun     = promoteCommand.Flag("dryRun", "Only show what would change").Bool()
+	promoteSetCommand = promoteCommand.Command("set", "Replace the promoted articles of a section").Default()
+	promoteSectionId  = promoteSetCommand.Arg("section ID", "The section ID to promote articles in").Required().String()
+	promoteArticleIds = promoteSetCommand.Arg("article IDs", "The article IDs to promote. If none, then promoted articles will be removed").Strings()
+
+	promoteAddCommand   = promoteCommand.Command("add", "Promote an article in a section, or move an already promoted article")
+	promoteAddSectionId = promoteAddCommand.Arg("section ID", "The section ID to promote the article in").Required().String()
+	promoteAddArticleId = promoteAddCommand.Arg("article ID", "The article ID to promote").Required().String()
+	promoteAddPosition  = promoteAddCommand.Flag("position", "The 0 based position to put the article at. Defaults to the end").Default("-1").Int()
+	promoteAddFor       = promoteAddCommand.Flag("for", "Only promote the article for this long, e.g. 6h. It is dropped by the next `promote tick` after it expires").Duration()
+
+	promoteRemoveCommand   = promoteCommand.Command("remove", "Stop promoting an article in a section")
+	promoteRemoveSectionId = promoteRemoveCommand.Arg("section ID", "The section ID to remove the article from").Required().String()
+	promoteRemoveArticleId = promoteRemoveCommand.Arg("article ID", "The article ID to stop promoting").Required().String()
+
+	promoteShowCommand   = promoteCommand.Command("show", "Show the promoted articles and saved snapshots of a section")
+	promoteShowSectionId = promoteShowCommand.Arg("section ID", "The section ID to show").Required().String()
+
+	promoteRestoreCommand    = promoteCommand.Command("restore", "Restore a snapshot of the promoted articles of a section")
+	promoteRestoreSectionId  = promoteRestoreCommand.Arg("section ID", "The section ID to restore").Required().String()
+	promoteRestoreSnapshotId = promoteRestoreCommand.Arg("snapshot ID", "The snapshot to restore. Defaults to the one before the latest").String()
+
+	promoteTickCommand = promoteCommand.Command("tick", "Drop expired time-boxed promotions from their sections")
+	promoteTickEvery   = promoteTickCommand.Flag("every", "Keep running and rotate at this interval, e.g. 5m").Duration()
+
+	convertCommand          = kingpin.Command("convert", "Convert other formats to Apple News Format bundles")
+	convertMarkdownCommand  = convertCommand.Command("markdown", "Convert a Markdown file to a bundle")
+	convertMarkdownFile     = convertMarkdownCommand.Arg("file", "The Markdown file to convert").Required().ExistingFile()
+	convertMarkdownOut      = convertMarkdownCommand.Flag("out", "The bundle directory to write. Defaults to the file name without its extension").String()
+	convertMarkdownTitle    = convertMarkdownCommand.Flag("title", "The article title. Defaults to a leading level 1 heading").String()
+	convertMarkdownId       = convertMarkdownCommand.Flag("identifier", "The document identifier. Defaults to a slug of the title").String()
+	convertMarkdownLanguage = convertMarkdownCommand.Flag("language", "The language of the article").Default("en").String()
+
+	convertHtmlCommand  = convertCommand.Command("html", "Convert an HTML body, such as a CMS produces, to a bundle")
+	convertHtmlFile     = convertHtmlCommand.Arg("file", "The HTML file to convert").Required().ExistingFile()
+	convertHtmlOut      = convertHtmlCommand.Flag("out", "The bundle directory to write. Defaults to the file name without its extension").String()
+	convertHtmlTitle    = convertHtmlCommand.Flag("title", "The article title. Defaults to a leading h1").String()
+	convertHtmlId       = convertHtmlCommand.Flag("identifier", "The document identifier. Defaults to a slug of the title").String()
+	convertHtmlLanguage = convertHtmlCommand.Flag("language", "The language of the article").Default("en").String()
+
+	previewCommand    = kingpin.Command("preview", "Serve an approximate HTML preview of a bundle that reloads as the bundle changes")
+	previewBundlePath = previewCommand.Arg("bundlePath", "Path to the bundle directory").Required().ExistingDir()
+	previewListen     = previewCommand.Flag("listen", "The address to serve the preview on").Default("localhost:8037").String()
+
+	proxyCommand   = kingpin.Command("proxy", "Forward API calls from internal services, signed with this channel's credentials, so the services don't need them")
+	proxyConfig    = proxyCommand.Flag("config", `A JSON file listing the services allowed to call, e.g. {"clients": [{"name": "cms", "token": "...", "allow": ["ReadArticle", "UpdateArticle"]}]}`).Required().ExistingFile()
+	proxyListen    = proxyCommand.Flag("listen", "The address to serve the proxy on").Default("localhost:8038").String()
+	proxyAccessLog = proxyCommand.Flag("accessLog", "Where to append a JSON line for every call, refused ones included. Changes are recorded in the audit log too. Defaults to proxy_audit.jsonl in the state directory").String()
+
+	watchCommand    = kingpin.Command("watch", "Publish a bundle as a preview of an article every time it changes")
+	watchBundlePath = watchCommand.Arg("bundlePath", "Path to the bundle directory").Required().ExistingDir()
+	watchArticleId  = watchCommand.Flag("article", "The (apple) ID of the article to update").Required().String()
+	watchDebounce   = watchCommand.Flag("debounce", "Wait until the bundle hasn't changed for this long before uploading").Default("500ms").Duration()
+
+	ingestCommand       = kingpin.Command("ingest", "Ingest content from other sources into the channel")
+	ingestFeedCommand   = ingestCommand.Command("feed", "Create or update an article for every new or changed item of an RSS or Atom feed")
+	ingestFeedSource    = ingestFeedCommand.Arg("source", "The path or URL of the feed").Required().String()
+	ingestFeedBundleDir = ingestFeedCommand.Flag("bundleDir", "Where to write the bundles of the items. Defaults to the ingest directory in the state directory").String()
+	ingestFeedDryRun    = ingestFeedCommand.Flag("dryRun", "Only convert the items and show what would be created or updated").Bool()
+	ingestFeedRules     = ingestFeedCommand.Flag("sectionRules", "A JSON file mapping item categories to sections. Defaults to section_rules.json in the state directory, if it exists").String()
+	ingestFeedOptions   = newCreateUpdateOptions(ingestFeedCommand)
+
+	deleteCommand     = kingpin.Command("delete", "Delete an article, or every article matching --where, after showing their titles and asking for confirmation")
+	deleteArticleId   = deleteCommand.Arg("article ID", "The ID of the article to delete").String()
+	deleteWhere       = deleteCommand.Flag("where", "Delete every article matching this condition instead, e.g. state=LIVE, title~^Test, section=Sports, from=2024-01-01 or to=2024-02-01. Repeat to match all of them").Strings()
+	deleteDryRun      = deleteCommand.Flag("dryRun", "With --where, only list the articles that would be deleted").Bool()
+	deleteConcurrency = deleteCommand.Flag("concurrency", "With --where, how many articles to delete at a time").Default("4").Int()
+	deleteYes         = deleteCommand.Flag("yes", "Delete without asking for confirmation").Short('y').Bool()
+	deleteBackup      = deleteCommand.Flag("backup", "Save the article's article.json and metadata before deleting it").Default("true").Bool()
+	deleteBackupDir   = deleteCommand.Flag("backupDir", "Where to save backups. Defaults to the backups directory in the state directory").String()
+	deleteSoft        = deleteCommand.Flag("soft", "Only hide the article, and delete it with the first `purge` after the grace period").Bool()
+	deleteGrace       = deleteCommand.Flag("grace", "With --soft, how long the article can still be restored with `undelete`").Default("168h").Duration()
+
+	hideCommand     = kingpin.Command("hide", "Hide an article, or every article matching --where, so it no longer appears in the channel")
+	hideArticleId   = hideCommand.Arg("article ID", "The ID of the article to hide").String()
+	hideWhere       = hideCommand.Flag("where", "Hide every article matching this condition instead, as for delete --where. Repeat to match all of them").Strings()
+	hideDryRun      = hideCommand.Flag("dryRun", "With --where, only list the articles that would be hidden").Bool()
+	hideConcurrency = hideCommand.Flag("concurrency", "With --where, how many articles to hide at a time").Default("4").Int()
+	hideYes         = hideCommand.Flag("yes", "With --where, hide without asking for confirmation").Short('y').Bool()
+
+	undeleteCommand   = kingpin.Command("undelete", "Show a soft deleted article again and cancel its deletion")
+	undeleteArticleId = undeleteCommand.Arg("article ID", "The ID of the article to restore").Required().String()
+
+	purgeCommand = kingpin.Command("purge", "Delete the soft deleted articles whose grace period is over")
+	purgeEvery   = purgeCommand.Flag("every", "Keep running and purge at this interval, e.g. 1h").Duration()
+
+	auditCommand   = kingpin.Command("audit", "Show the changes made to the channel, newest first")
+	auditArticleId = auditCommand.Flag("articleId", "Only show changes to this article").String()
+	auditSince     = auditCommand.Flag("since", "Only show changes made within this long ago, e.g. 48h").Duration()
+	auditLimit     = auditCommand.Flag("limit", "The maximum number of changes to show").Default("20").Int()
+
+	pushCommand           = kingpin.Command("push", "Send push notifications and browse the notification history")
+	pushSendCommand       = pushCommand.Command("send", "Send a push notification").Default()
+	notificationArticleId = pushSendCommand.Arg("articleId", "The apple ID of the article to send the notification to").Required().String()
+	alertBody             = pushSendCommand.Arg("alertBody", "The body of the push notification to send").Required().String()
+	countries             = pushSendCommand.Flag("countries", "The countries to send the push notificstion to").HintOptions(api.CountryEU, api.CountryGB, api.CountryUS).Enums(api.CountryEU, api.CountryGB, api.CountryUS)
+	ignoreWarnings        = pushSendCommand.Flag("ignoreWarnings", "Ignore warnings about alert length. (Best practice is <= 130 characters, and anything > 500 chars will be truncated.)").Bool()
+	dedupeWindow          = pushSendCommand.Flag("dedupeWindow", "Refuse to notify an article that was already notified within this window").Default("24h").Duration()
+	forcePush             = pushSendCommand.Flag("force", "Send even if the article was already notified within the dedupe window").Bool()
+
+	pushHistoryCommand   = pushCommand.Command("history", "Show previously sent notifications, newest first")
+	pushHistoryArticleId = pushHistoryCommand.Flag("articleId", "Only show notifications for this article").String()
+	pushHistorySince     = pushHistoryCommand.Flag("since", "Only show notifications sent within this long ago, e.g. 48h").Duration()
+	pushHistoryLimit     = pushHistoryCommand.Flag("limit", "The maximum number of notifications to show").Default("20").Int()
 )
 
 func main() {
@@ -69,6 +183,38 @@ func main() {
 
 	c := api.NewClient(&http.Client{}, key, secret, baseURL, channelID)
 
+	c.CorrectClockSkew = *correctClockSkew
+	c.Operator = *operator
+	c.Audit = auditSinks()
+
+	if *cacheTTL > 0 || command == "cache clear" {
+		cache, err := api.NewMetadataCache(*cacheTTL, filepath.Join(*stateDir, "metadata_cache.json"))
+		if err != nil {
+			errorAndDie(err)
+		}
+		c.MetadataCache = cache
+	}
+
+	if len(*metricsListen) > 0 {
+		serveMetrics(c, *metricsListen)
+	}
+
+	//Added after the other middleware so it logs requests as they are sent
+	if *verbose > 0 {
+		level := slog.LevelInfo
+		if *verbose > 1 {
+			level = slog.LevelDebug
+		}
+		logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: level}))
+		c.Use(api.LoggingMiddleware(logger, *verbose > 1, c.APISecret))
+	}
+
+	if *processImages {
+		c.ImageProcessor = api.NewImageProcessor(filepath.Join(*stateDir, "image_cache"))
+		c.ImageProcessor.MaxDimension = *maxImageDimension
+		c.ImageProcessor.JpegQuality = *jpegQuality
+	}
+
 	switch command {
 	case "read article":
 		resp, err := c.ReadArticle(articleID)
@@ -119,6 +265,11 @@ func main() {
 		}
 		fmt.Println(string(j))
 
+	case "cache clear":
+		if err := c.MetadataCache.Clear(); err != nil {
+			errorAndDie(err)
+		}
+
 	case "search":
 		if from, err := time.Parse("2006-01-02", *searchFromDate); err == nil {
 			searchOptions.FromDate = &from
@@ -137,22 +288,19 @@ func main() {
 		fmt.Println(string(j))
 
 	case "create":
-		articleJsonFile, err := os.Open(filepath.Join(*bundlePath, "article.json"))
-		if err != nil {
-			errorAndDie(err)
-		}
+		bundle := openBundle(*bundlePath, *createTypes)
+		defer bundle.Close()
 
-		articleBytes, err := ioutil.ReadAll(articleJsonFile)
+		articleBytes, err := bundle.Article()
 		if err != nil {
 			errorAndDie(err)
 		}
 
-		bundleComponents, err := api.GetBundleComponents(bytes.NewReader(articleBytes), *bundlePath)
-		if err != nil {
+		if err := applySections(c, createOptions, createRules, articleBytes, true); err != nil {
 			errorAndDie(err)
 		}
 
-		resp, err := c.CreateArticle(bytes.NewReader(articleBytes), bundleComponents, createOptions)
+		resp, err := c.CreateArticleBundle(bundle, createOptions)
 		if err != nil {
 			errorAndDie(err)
 		}
@@ -160,58 +308,170 @@ func main() {
 		printResponse(resp)
 	case "update":
 		if len(*updateBundlePath) > 0 {
-			articleJsonFile, err := os.Open(filepath.Join(*updateBundlePath, "article.json"))
-			if err != nil {
-				errorAndDie(err)
-			}
-			defer articleJsonFile.Close()
+			bundle := openBundle(*updateBundlePath, *updateTypes)
+			defer bundle.Close()
 
-			articleBytes, err := ioutil.ReadAll(articleJsonFile)
+			articleBytes, err := bundle.Article()
 			if err != nil {
 				errorAndDie(err)
 			}
 
-			bundleComponents, err := api.GetBundleComponents(bytes.NewReader(articleBytes), *updateBundlePath)
-			if err != nil {
+			if err := applySections(c, updateOptions, updateRules, articleBytes, false); err != nil {
 				errorAndDie(err)
 			}
 
-			resp, err := c.UpdateArticle(*updateArticleId, *revision, bytes.NewReader(articleBytes), bundleComponents, updateOptions)
+			resp, err := c.UpdateArticleBundle(*updateArticleId, *revision, bundle, updateOptions)
 			if err != nil {
 				errorAndDie(err)
 			}
 			printResponse(resp)
 		} else {
+			if err := applySections(c, updateOptions, updateRules, nil, false); err != nil {
+				errorAndDie(err)
+			}
 			resp, err := c.UpdateArticleMetadata(articleID, updateOptions)
 			if err != nil {
 				errorAndDie(err)
 			}
 			printResponse(resp)
 		}
-	case "promote":
-		resp, err := c.PromoteArticles(*promoteSectionId, *promoteArticleIds)
+	case "promote set":
+		m := promotedArticlesManager(c)
+		printResponse(applyPromotedArticles(m, *promoteSectionId, currentPromotedArticles(m, *promoteSectionId), *promoteArticleIds))
+	case "promote add":
+		//The section is read once, so what is applied is the list the operator confirmed
+		m := promotedArticlesManager(c)
+		current := currentPromotedArticles(m, *promoteAddSectionId)
+		articleIds := api.AddPromotedArticle(current, *promoteAddArticleId, *promoteAddPosition)
+		if *promoteAddFor <= 0 {
+			printResponse(applyPromotedArticles(m, *promoteAddSectionId, current, articleIds))
+		}
+		if !confirmPromotedArticles(*promoteAddSectionId, current, articleIds, true) {
+			printResponse(nil)
+		}
+		resp, err := promotionRotation(m).Promote(*promoteAddSectionId, articleIds, *promoteAddArticleId, *promoteAddFor)
 		if err != nil {
 			errorAndDie(err)
 		}
 		printResponse(resp)
+	case "promote remove":
+		m := promotedArticlesManager(c)
+		current := currentPromotedArticles(m, *promoteRemoveSectionId)
+		articleIds := api.RemovePromotedArticle(current, *promoteRemoveArticleId)
+		resp := applyPromotedArticles(m, *promoteRemoveSectionId, current, articleIds)
+		//Also when it had already been removed, so promote tick doesn't try to drop it again
+		if resp != nil || len(articleIds) == len(current) && !*promoteDryRun {
+			if err := promotionRotation(m).Forget(*promoteRemoveSectionId, *promoteRemoveArticleId); err != nil {
+				errorAndDie(err)
+			}
+		}
+		printResponse(resp)
+	case "promote show":
+		showPromotedArticles(promotedArticlesManager(c), *promoteShowSectionId)
+	case "promote restore":
+		printResponse(restorePromotedArticles(promotedArticlesManager(c), *promoteRestoreSectionId, *promoteRestoreSnapshotId))
+	case "promote tick":
+		rotatePromotions(promotionRotation(promotedArticlesManager(c)), *promoteTickEvery)
+	case "convert markdown":
+		convertMarkdown(*convertMarkdownFile, *convertMarkdownOut, anf.MarkdownOptions{
+			Identifier: *convertMarkdownId,
+			Title:      *convertMarkdownTitle,
+			Language:   *convertMarkdownLanguage,
+			BaseDir:    filepath.Dir(*convertMarkdownFile),
+		})
+	case "convert html":
+		convertHtml(*convertHtmlFile, *convertHtmlOut, anf.HtmlOptions{
+			Identifier: *convertHtmlId,
+			Title:      *convertHtmlTitle,
+			Language:   *convertHtmlLanguage,
+			BaseDir:    filepath.Dir(*convertHtmlFile),
+		})
+	case "preview":
+		servePreview(*previewBundlePath, *previewListen)
+	case "proxy":
+		auditPath := *proxyAccessLog
+		if len(auditPath) == 0 {
+			auditPath = filepath.Join(*stateDir, "proxy_audit.jsonl")
+		}
+		serveProxy(c, *proxyListen, *proxyConfig, auditPath)
+	case "watch":
+		watchBundle(c, *watchBundlePath, *watchArticleId, *watchDebounce)
+	case "ingest feed":
+		ingestFeed(c, *ingestFeedSource, *ingestFeedBundleDir, *ingestFeedRules, *ingestFeedOptions, *ingestFeedDryRun)
 	case "delete":
-		err := c.DeleteArticle(*deleteArticleId)
+		if len(*deleteWhere) > 0 {
+			requireNoArticleId(*deleteArticleId)
+			soft := softDeletions(c)
+			bulkApply(c, *deleteWhere, "Delete", *deleteYes, *deleteDryRun, *deleteConcurrency, func(article api.SearchArticle) error {
+				_, err := removeArticle(c, soft, article.ID)
+				return err
+			})
+		}
+		if len(*deleteArticleId) == 0 {
+			errorAndDie(fmt.Errorf("give an article ID or --where conditions"))
+		}
+		deleteArticle(c, *deleteArticleId)
+	case "hide":
+		if len(*hideWhere) > 0 {
+			requireNoArticleId(*hideArticleId)
+			bulkApply(c, *hideWhere, "Hide", *hideYes, *hideDryRun, *hideConcurrency, func(article api.SearchArticle) error {
+				_, err := c.HideArticle(article.ID, true)
+				return err
+			})
+		}
+		if len(*hideArticleId) == 0 {
+			errorAndDie(fmt.Errorf("give an article ID or --where conditions"))
+		}
+		resp, err := c.HideArticle(*hideArticleId, true)
 		if err != nil {
 			errorAndDie(err)
 		}
-	case "push":
+		printResponse(resp)
+	case "undelete":
+		resp, err := softDeletions(c).Restore(*undeleteArticleId)
+		if err != nil {
+			errorAndDie(err)
+		}
+		printResponse(resp)
+	case "purge":
+		purgeArticles(softDeletions(c), *purgeEvery)
+	case "push send":
+		c.NotificationLog = notificationLog()
+		if *forcePush {
+			c.NotificationLog.DedupeWindow = 0
+		}
 		resp, err := c.SendNotification(*notificationArticleId, *alertBody, *countries, *ignoreWarnings)
 		if err != nil {
 			errorAndDie(err)
 		}
 		printResponse(resp)
+	case "audit":
+		if auditLogPath() == "" {
+			errorAndDie(fmt.Errorf("the audit log is turned off"))
+		}
+		entries, err := api.NewAuditLog(auditLogPath()).Entries()
+		if err != nil {
+			errorAndDie(err)
+		}
+		printResponse(filterLogEntries(entries, func(e api.AuditEntry) (string, time.Time) {
+			return e.ArticleID, e.Time
+		}, *auditArticleId, *auditSince, *auditLimit))
+
+	case "push history":
+		entries, err := notificationLog().Entries()
+		if err != nil {
+			errorAndDie(err)
+		}
+		printResponse(filterLogEntries(entries, func(e api.NotificationLogEntry) (string, time.Time) {
+			return e.ArticleID, e.SentAt
+		}, *pushHistoryArticleId, *pushHistorySince, *pushHistoryLimit))
 	}
 
 }
 
 func newCreateUpdateOptions(cmd *kingpin.CmdClause) *api.Metadata {
 	options := &api.Metadata{}
-	cmd.Flag("sections", "The sections the article should appear in").StringsVar(&options.Data.Links.Sections)
+	cmd.Flag("sections", "The sections the article should appear in, as links, IDs or names. Separate several with commas, e.g. Sports,Tech").StringsVar(&options.Data.Links.Sections)
 	cmd.Flag("isSponsored", "Marks the article as sponsored").BoolVar(&options.Data.IsSponsored)
 	cmd.Flag("isPreview", "Sets the article to preview mode").BoolVar(&options.Data.IsPreview)
 	cmd.Flag("accessoryText", "Sets text below the article excerpt in channel view. Default is the author").StringVar(&options.Data.AccessoryText)
@@ -229,6 +489,42 @@ func newSearchOptions(cmd *kingpin.CmdClause) *api.SearchArticlesOptions {
 	return defaultSearchOpts
 }
 
+func defaultStateDir() string {
+	if dir := os.Getenv("ANEWS_STATE_DIR"); len(dir) > 0 {
+		return dir
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ".anews"
+	}
+	return filepath.Join(home, ".anews")
+}
+
+func notificationLog() *api.NotificationLog {
+	return api.NewNotificationLog(filepath.Join(*stateDir, "notifications.jsonl"), *dedupeWindow, *operator)
+}
+
+//Returns the newest entries first, keeping those of articleID when it isn't empty and those from within since when it
+//is greater than zero, at most limit of them when it is. key gives the article and time of an entry
+func filterLogEntries[T any](entries []T, key func(T) (string, time.Time), articleID string, since time.Duration, limit int) []T {
+	filtered := make([]T, 0)
+	for i := len(entries) - 1; i >= 0 && (limit <= 0 || len(filtered) < limit); i-- {
+		entryArticleID, t := key(entries[i])
+		if len(articleID) > 0 && entryArticleID != articleID {
+			continue
+		}
+		if since > 0 && time.Since(t) > since {
+			continue
+		}
+		filtered = append(filtered, entries[i])
+	}
+	return filtered
+}
+
+func isURL(s string) bool {
+	return strings.HasPrefix(s, "http://") || strings.HasPrefix(s, "https://")
+}
+
 func printResponse(resp interface{}) {
 	respBytes, err := json.Marshal(resp)
 	if err != nil {
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"net"
+	"net/http"
+
+	"github.com/sdotz/apple-news-push-api/pkg/api"
+	"github.com/sdotz/apple-news-push-api/pkg/metrics"
+)
+
+//Measures the calls c makes and serves the metrics in the background for as long as the command runs
+func serveMetrics(c *api.Client, listen string) {
+	m := metrics.New()
+	c.Use(m.Middleware())
+
+	l, err := net.Listen("tcp", listen)
+	if err != nil {
+		errorAndDie(err)
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", m)
+	go func() {
+		if err := http.Serve(l, mux); err != nil {
+			errorAndDie(err)
+		}
+	}()
+}
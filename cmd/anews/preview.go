@@ -0,0 +1,17 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/sdotz/apple-news-push-api/pkg/anf"
+)
+
+//Serves a preview of the bundle until interrupted
+func servePreview(bundlePath string, listen string) {
+	fmt.Fprintf(os.Stderr, "Previewing %s at http://%s/\n", bundlePath, listen)
+	if err := http.ListenAndServe(listen, &anf.PreviewHandler{Dir: bundlePath}); err != nil {
+		errorAndDie(err)
+	}
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/sdotz/apple-news-push-api/pkg/api"
+)
+
+type promotedArticlesState struct {
+	SectionID        string                         `json:"sectionId"`
+	PromotedArticles []string                       `json:"promotedArticles"`
+	Expiring         []api.PromotionEntry           `json:"expiring"`
+	Snapshots        []api.PromotedArticlesSnapshot `json:"snapshots"`
+}
+
+func promotedArticlesManager(c *api.Client) *api.PromotedArticlesManager {
+	return api.NewPromotedArticlesManager(c, filepath.Join(*stateDir, "promoted"), *operator)
+}
+
+func promotionRotation(m *api.PromotedArticlesManager) *api.PromotionRotation {
+	return api.NewPromotionRotation(m, filepath.Join(*stateDir, "promotions.json"))
+}
+
+func currentPromotedArticles(m *api.PromotedArticlesManager, sectionID string) []string {
+	current, err := m.Current(sectionID)
+	if err != nil {
+		errorAndDie(err)
+	}
+	return current
+}
+
+//Shows the diff between the current and the new promoted articles on stderr, then applies them once confirmed.
+//Returns nil when nothing was applied
+func applyPromotedArticles(m *api.PromotedArticlesManager, sectionID string, current []string, articleIDs []string) *api.PromoteArticlesResponse {
+	if !confirmPromotedArticles(sectionID, current, articleIDs, false) {
+		return nil
+	}
+	resp, err := m.Apply(sectionID, articleIDs)
+	if err != nil {
+		errorAndDie(err)
+	}
+	return resp
+}
+
+//Shows the diff between the current and the new promoted articles on stderr and asks whether to go ahead. Returns
+//false for a dry run, and when nothing would change unless renewing, as promoting a time-boxed article again renews
+//its expiry
+func confirmPromotedArticles(sectionID string, current []string, articleIDs []string, renewing bool) bool {
+	diff := api.DiffPromotedArticles(current, articleIDs)
+	fmt.Fprintf(os.Stderr, "Promoted articles of section %s:\n%s\n", sectionID, diff)
+	if *promoteDryRun || diff.IsEmpty() && !renewing {
+		return false
+	}
+	if !*promoteYes && !confirm("Apply these changes?") {
+		errorAndDie(fmt.Errorf("aborted"))
+	}
+	return true
+}
+
+func showPromotedArticles(m *api.PromotedArticlesManager, sectionID string) {
+	current := currentPromotedArticles(m, sectionID)
+	snapshots, err := m.Snapshots(sectionID)
+	if err != nil {
+		errorAndDie(err)
+	}
+	entries, err := promotionRotation(m).Entries()
+	if err != nil {
+		errorAndDie(err)
+	}
+	expiring := make([]api.PromotionEntry, 0)
+	for _, e := range entries {
+		if e.SectionID == sectionID {
+			expiring = append(expiring, e)
+		}
+	}
+	printResponse(promotedArticlesState{
+		SectionID:        sectionID,
+		PromotedArticles: current,
+		Expiring:         expiring,
+		Snapshots:        snapshots,
+	})
+}
+
+func restorePromotedArticles(m *api.PromotedArticlesManager, sectionID string, snapshotID string) *api.PromoteArticlesResponse {
+	var snapshot *api.PromotedArticlesSnapshot
+	var err error
+	if len(snapshotID) > 0 {
+		snapshot, err = m.Snapshot(sectionID, snapshotID)
+	} else {
+		snapshot, err = m.PreviousSnapshot(sectionID)
+	}
+	if err != nil {
+		errorAndDie(err)
+	}
+	fmt.Fprintf(os.Stderr, "Restoring snapshot %s taken at %s\n", snapshot.ID, snapshot.TakenAt)
+	return applyPromotedArticles(m, sectionID, currentPromotedArticles(m, sectionID), snapshot.PromotedArticles)
+}
+
+//Runs a single rotation, or keeps rotating every interval when it is greater than zero
+func rotatePromotions(r *api.PromotionRotation, every time.Duration) {
+	if every <= 0 {
+		results, err := r.Tick(r.Manager.Client.Now())
+		if err != nil {
+			errorAndDie(err)
+		}
+		printResponse(results)
+	}
+
+	err := r.Run(context.Background(), every, func(results []api.RotationResult, err error) {
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			return
+		}
+		if len(results) > 0 {
+			j, _ := json.Marshal(results)
+			fmt.Println(string(j))
+		}
+	})
+	if err != nil {
+		errorAndDie(err)
+	}
+}
+
+//Asks a yes/no question on stderr. When stdin isn't a terminal there is nobody to ask, so the answer is no: scripts
+//and cron jobs have to pass --yes to make changes
+func confirm(question string) bool {
+	if fi, err := os.Stdin.Stat(); err != nil || fi.Mode()&os.ModeCharDevice == 0 {
+		fmt.Fprintf(os.Stderr, "%s Refusing without a terminal to confirm on, pass --yes to go ahead\n", question)
+		return false
+	}
+	fmt.Fprintf(os.Stderr, "%s [y/N] ", question)
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/sdotz/apple-news-push-api/pkg/api"
+)
+
+//Serves a signing proxy until interrupted, appending every call to the audit log as a JSON line
+func serveProxy(c *api.Client, listen string, configPath string, auditPath string) {
+	config, err := api.LoadProxyConfig(configPath)
+	if err != nil {
+		errorAndDie(err)
+	}
+	if err := os.MkdirAll(filepath.Dir(auditPath), 0755); err != nil {
+		errorAndDie(err)
+	}
+	auditLog, err := os.OpenFile(auditPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		errorAndDie(err)
+	}
+	defer auditLog.Close()
+
+	var mu sync.Mutex
+	encoder := json.NewEncoder(auditLog)
+	proxy := api.NewSigningProxy(c, config.Clients)
+	proxy.Audit = func(entry api.ProxyAuditEntry) {
+		mu.Lock()
+		defer mu.Unlock()
+		if err := encoder.Encode(entry); err != nil {
+			fmt.Fprintf(os.Stderr, "Couldn't write to the audit log: %s\n", err)
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "Proxying %s for %d clients at http://%s/\n", c.BaseURL, len(config.Clients), listen)
+	if err := http.ListenAndServe(listen, proxy); err != nil {
+		errorAndDie(err)
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/sdotz/apple-news-push-api/pkg/api"
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+type sectionRuleOptions struct {
+	rulesPath  string
+	categories []string
+	tags       []string
+}
+
+func newSectionRuleOptions(cmd *kingpin.CmdClause) *sectionRuleOptions {
+	options := &sectionRuleOptions{}
+	cmd.Flag("sectionRules", "A JSON file mapping CMS categories and tags to sections. Defaults to section_rules.json in the state directory, if it exists").StringVar(&options.rulesPath)
+	cmd.Flag("category", "A CMS category of the article, matched against the section rules").StringsVar(&options.categories)
+	cmd.Flag("tag", "A CMS tag of the article, matched against the section rules. The keywords of article.json are used as tags too").StringsVar(&options.tags)
+	return options
+}
+
+//Adds the sections matched by the section rules to the metadata, then resolves every section name or ID to its link.
+//The rules' default sections are only used when creating, so an update that matches nothing leaves the sections alone
+func applySections(c *api.Client, metadata *api.Metadata, options *sectionRuleOptions, articleBytes []byte, creating bool) error {
+	rules, err := loadSectionRules(options.rulesPath)
+	if err != nil {
+		return err
+	}
+
+	sections := metadata.Data.Links.Sections
+	if rules != nil {
+		tags := options.tags
+		if articleBytes != nil {
+			keywords, err := api.ArticleKeywords(articleBytes)
+			if err != nil {
+				return err
+			}
+			tags = append(tags, keywords...)
+		}
+		matched := rules.Sections(options.categories, tags)
+		if creating && len(matched) == 0 && len(sections) == 0 {
+			matched = rules.Default
+		}
+		sections = append(sections, matched...)
+	}
+	if len(sections) == 0 {
+		return nil
+	}
+
+	resolved, err := c.ResolveSections(sections)
+	if err != nil {
+		return err
+	}
+	metadata.Data.Links.Sections = resolved
+	return nil
+}
+
+//Returns nil when no rules file was given and there is none in the state directory
+func loadSectionRules(path string) (*api.SectionRules, error) {
+	if len(path) == 0 {
+		path = filepath.Join(*stateDir, "section_rules.json")
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			return nil, nil
+		}
+	}
+	return api.LoadSectionRules(path)
+}
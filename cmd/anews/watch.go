@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/sdotz/apple-news-push-api/pkg/anf"
+	"github.com/sdotz/apple-news-push-api/pkg/api"
+)
+
+//Re-publishes the bundle as a preview of the article every time it changes. The revision is taken from each update's
+//response, and read again after a failed update in case the article was changed elsewhere
+type previewPublisher struct {
+	client     *api.Client
+	bundlePath string
+	articleID  string
+	revision   string
+}
+
+func watchBundle(c *api.Client, bundlePath string, articleID string, debounce time.Duration) {
+	p := &previewPublisher{client: c, bundlePath: bundlePath, articleID: articleID}
+	if err := p.readRevision(); err != nil {
+		errorAndDie(err)
+	}
+
+	fmt.Fprintf(os.Stderr, "Watching %s for changes to article %s\n", bundlePath, articleID)
+	err := anf.NewBundleWatcher(bundlePath, debounce).Watch(context.Background(), func() {
+		resp, err := p.publish()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			return
+		}
+		j, _ := json.Marshal(resp)
+		fmt.Println(string(j))
+	})
+	if err != nil {
+		errorAndDie(err)
+	}
+}
+
+func (p *previewPublisher) publish() (*api.ReadArticleResponse, error) {
+	if err := anf.ValidateBundle(p.bundlePath); err != nil {
+		return nil, err
+	}
+	if len(p.revision) == 0 {
+		if err := p.readRevision(); err != nil {
+			return nil, err
+		}
+	}
+
+	bundle, err := api.NewDirBundle(p.bundlePath)
+	if err != nil {
+		return nil, err
+	}
+	bundle.FontDir = *fontDir
+
+	metadata := &api.Metadata{}
+	metadata.Data.IsPreview = true
+	resp, err := p.client.UpdateArticleBundle(p.articleID, p.revision, bundle, metadata)
+	if err != nil {
+		p.revision = ""
+		return nil, err
+	}
+	p.revision = resp.Data.Revision
+	return resp, nil
+}
+
+func (p *previewPublisher) readRevision() error {
+	resp, err := p.client.ReadArticle(p.articleID)
+	if err != nil {
+		return err
+	}
+	p.revision = resp.Data.Revision
+	return nil
+}
@@ -0,0 +1,228 @@
+//Package anf builds Apple News Format documents and bundles that can be uploaded with the api package
+package anf
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+const (
+	Version = "1.7"
+
+	FormatMarkdown = "markdown"
+	FormatHtml     = "html"
+
+	RoleTitle         = "title"
+	RoleByline        = "byline"
+	RoleBody          = "body"
+	RoleQuote         = "quote"
+	RolePhoto         = "photo"
+	RoleFigure        = "figure"
+	RoleDivider       = "divider"
+	RoleCaption       = "caption"
+	RoleInstagram     = "instagram"
+	RoleTweet         = "tweet"
+	RoleFacebook      = "facebook_post"
+	RoleEmbedWebVideo = "embedwebvideo"
+	RoleHtmlTable     = "htmltable"
+)
+
+//An Apple News Format article.json, limited to the properties the converters in this package produce
+type Document struct {
+	Version             string                        `json:"version"`
+	Identifier          string                        `json:"identifier"`
+	Title               string                        `json:"title"`
+	Subtitle            string                        `json:"subtitle,omitempty"`
+	Language            string                        `json:"language"`
+	Layout              Layout                        `json:"layout"`
+	Components          []Component                   `json:"components"`
+	ComponentTextStyles map[string]ComponentTextStyle `json:"componentTextStyles"`
+	DocumentStyle       *DocumentStyle                `json:"documentStyle,omitempty"`
+	Metadata            *Metadata                     `json:"metadata,omitempty"`
+}
+
+type Layout struct {
+	Columns int `json:"columns"`
+	Width   int `json:"width"`
+	Margin  int `json:"margin,omitempty"`
+	Gutter  int `json:"gutter,omitempty"`
+}
+
+type Component struct {
+	Role       string      `json:"role"`
+	Identifier string      `json:"identifier,omitempty"`
+	Text       string      `json:"text,omitempty"`
+	Format     string      `json:"format,omitempty"`
+	URL        string      `json:"URL,omitempty"`
+	Caption    string      `json:"caption,omitempty"`
+	HTML       string      `json:"html,omitempty"`
+	TextStyle  string      `json:"textStyle,omitempty"`
+	Components []Component `json:"components,omitempty"`
+}
+
+type ComponentTextStyle struct {
+	FontName               string `json:"fontName,omitempty"`
+	FontSize               int    `json:"fontSize,omitempty"`
+	LineHeight             int    `json:"lineHeight,omitempty"`
+	TextColor              string `json:"textColor,omitempty"`
+	TextAlignment          string `json:"textAlignment,omitempty"`
+	FontStyle              string `json:"fontStyle,omitempty"`
+	FontWeight             string `json:"fontWeight,omitempty"`
+	ParagraphSpacingBefore int    `json:"paragraphSpacingBefore,omitempty"`
+	ParagraphSpacingAfter  int    `json:"paragraphSpacingAfter,omitempty"`
+}
+
+type DocumentStyle struct {
+	BackgroundColor string `json:"backgroundColor,omitempty"`
+}
+
+type Metadata struct {
+	Authors       []string `json:"authors,omitempty"`
+	Excerpt       string   `json:"excerpt,omitempty"`
+	Keywords      []string `json:"keywords,omitempty"`
+	CanonicalURL  string   `json:"canonicalURL,omitempty"`
+	ThumbnailURL  string   `json:"thumbnailURL,omitempty"`
+	DatePublished string   `json:"datePublished,omitempty"`
+	DateModified  string   `json:"dateModified,omitempty"`
+}
+
+//A file that has to be copied into the bundle as Name, so it can be referenced as bundle://Name
+type Asset struct {
+	Name   string `json:"name"`
+	Source string `json:"source"`
+}
+
+//The result of converting some source into an ANF document
+type Conversion struct {
+	Document *Document `json:"-"`
+	Assets   []Asset   `json:"assets"`
+	//Human readable notes on anything in the source that couldn't be represented and was left out
+	Dropped []string `json:"dropped"`
+
+	assetNames map[string]string
+}
+
+//Creates an empty document with a layout and default text styles that render reasonably as is
+func NewDocument(identifier string, title string, language string) *Document {
+	if len(language) == 0 {
+		language = "en"
+	}
+	if len(identifier) == 0 {
+		identifier = Slug(title)
+	}
+	return &Document{
+		Version:    Version,
+		Identifier: identifier,
+		Title:      title,
+		Language:   language,
+		Layout: Layout{
+			Columns: 7,
+			Width:   1024,
+			Margin:  70,
+			Gutter:  40,
+		},
+		Components: []Component{},
+		ComponentTextStyles: map[string]ComponentTextStyle{
+			"default": {
+				FontName:   "HelveticaNeue",
+				FontSize:   17,
+				LineHeight: 25,
+				TextColor:  "#222222",
+			},
+			"default-title": {
+				FontName: "HelveticaNeue-Bold",
+				FontSize: 40,
+			},
+			"default-quote": {
+				FontName: "Georgia-Italic",
+				FontSize: 22,
+			},
+		},
+	}
+}
+
+//Writes article.json and copies the assets into dir, creating it if needed
+func (c *Conversion) WriteBundle(dir string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	for _, a := range c.Assets {
+		if err := copyFile(a.Source, filepath.Join(dir, filepath.FromSlash(a.Name))); err != nil {
+			return err
+		}
+	}
+	b, err := json.MarshalIndent(c.Document, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(dir, "article.json"), b, 0644)
+}
+
+//Adds a local file to the bundle and returns its bundle:// URL. Adding the same file twice returns the same URL, and
+//different files with the same name are renamed
+func (c *Conversion) addAsset(source string) string {
+	if c.assetNames == nil {
+		c.assetNames = make(map[string]string)
+	}
+	for name, s := range c.assetNames {
+		if s == source {
+			return "bundle://" + name
+		}
+	}
+
+	base := filepath.Base(source)
+	ext := filepath.Ext(base)
+	name := base
+	for i := 2; len(c.assetNames[name]) > 0; i++ {
+		name = fmt.Sprintf("%s-%d%s", strings.TrimSuffix(base, ext), i, ext)
+	}
+	c.assetNames[name] = source
+	c.Assets = append(c.Assets, Asset{Name: name, Source: source})
+	return "bundle://" + name
+}
+
+func (c *Conversion) drop(format string, args ...interface{}) {
+	c.Dropped = append(c.Dropped, fmt.Sprintf(format, args...))
+}
+
+var nonSlugChars = regexp.MustCompile(`[^a-z0-9]+`)
+
+//Turns a title into something usable as a document identifier
+func Slug(s string) string {
+	slug := strings.Trim(nonSlugChars.ReplaceAllString(strings.ToLower(s), "-"), "-")
+	if len(slug) == 0 {
+		return "article"
+	}
+	return slug
+}
+
+func isRemoteURL(s string) bool {
+	return strings.HasPrefix(s, "http://") || strings.HasPrefix(s, "https://")
+}
+
+func copyFile(src string, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
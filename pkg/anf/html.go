@@ -0,0 +1,522 @@
+package anf
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+type HtmlOptions struct {
+	//Defaults to a slug of the title
+	Identifier string
+	//Defaults to the text of a leading h1, which then becomes the title component
+	Title    string
+	Language string
+	//The directory relative image paths are resolved against
+	BaseDir string
+	//The URL of the page the html came from. When set, relative and root-relative image paths are resolved against it
+	//and referenced remotely, and the local filesystem is never read
+	BaseURL string
+}
+
+//The inline elements ANF html formatted text supports, and the attributes kept on them
+var inlineHtmlElements = map[atom.Atom][]string{
+	atom.A:      {"href"},
+	atom.B:      nil,
+	atom.Strong: nil,
+	atom.I:      nil,
+	atom.Em:     nil,
+	atom.Br:     nil,
+	atom.Sub:    nil,
+	atom.Sup:    nil,
+	atom.Del:    nil,
+	atom.S:      nil,
+	atom.Code:   nil,
+	atom.Samp:   nil,
+}
+
+var containerHtmlElements = map[atom.Atom]bool{
+	atom.Html:    true,
+	atom.Body:    true,
+	atom.Div:     true,
+	atom.Section: true,
+	atom.Article: true,
+	atom.Main:    true,
+	atom.Header:  true,
+	atom.Footer:  true,
+	atom.Aside:   true,
+}
+
+var (
+	youtubeIdPattern = regexp.MustCompile(`^/(?:embed/|v/)?([\w-]{11})`)
+	vimeoIdPattern   = regexp.MustCompile(`/(?:video/)?(\d+)`)
+	tweetPattern     = regexp.MustCompile(`^https?://(?:www\.|mobile\.)?(?:twitter|x)\.com/\w+/status(?:es)?/\d+`)
+	instagramPattern = regexp.MustCompile(`^https?://(?:www\.)?instagram\.com/(?:p|reel|tv)/[\w-]+/?`)
+	whitespace       = regexp.MustCompile(`\s+`)
+)
+
+//Scripts that only load the widgets of embeds that are converted to social components anyway
+var embedLoaderScripts = []string{"platform.twitter.com/widgets.js", "instagram.com/embed.js", "connect.facebook.net"}
+
+//Converts sanitized HTML, such as the body a CMS produces, into an ANF document. Block elements are split into
+//components with html formatted text limited to what ANF supports, images and figures become photo components,
+//YouTube and Vimeo iframes become embedwebvideo components, and tweet and Instagram embeds become social components.
+//Anything that can't be represented is listed in Dropped
+func ConvertHtml(r io.Reader, options HtmlOptions) (*Conversion, error) {
+	root, err := html.Parse(r)
+	if err != nil {
+		return nil, err
+	}
+
+	hc := &htmlConverter{
+		Conversion: &Conversion{
+			Document: NewDocument(options.Identifier, options.Title, options.Language),
+			Dropped:  []string{},
+		},
+		options: options,
+		dropped: make(map[string]bool),
+	}
+	hc.children(root)
+	hc.flush()
+
+	if len(options.Title) == 0 {
+		hc.Document.Title = hc.title
+		if len(options.Identifier) == 0 {
+			hc.Document.Identifier = Slug(hc.title)
+		}
+	}
+	return hc.Conversion, nil
+}
+
+type htmlConverter struct {
+	*Conversion
+	options   HtmlOptions
+	paragraph strings.Builder
+	title     string
+	dropped   map[string]bool
+}
+
+func (hc *htmlConverter) children(n *html.Node) {
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		hc.node(child)
+	}
+}
+
+func (hc *htmlConverter) node(n *html.Node) {
+	switch n.Type {
+	case html.TextNode:
+		hc.paragraph.WriteString(html.EscapeString(n.Data))
+		return
+	case html.ElementNode:
+	case html.DocumentNode:
+		hc.children(n)
+		return
+	default:
+		return
+	}
+
+	switch n.DataAtom {
+	case atom.Head, atom.Style, atom.Noscript, atom.Template:
+		return
+	case atom.Script:
+		hc.script(n)
+	case atom.P:
+		hc.flush()
+		hc.children(n)
+		hc.flush()
+	case atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6:
+		hc.flush()
+		hc.heading(n)
+	case atom.Ul, atom.Ol:
+		hc.flush()
+		hc.text(RoleBody, hc.renderElement(n))
+	case atom.Pre:
+		hc.flush()
+		hc.text(RoleBody, "<pre>"+hc.renderChildren(n)+"</pre>")
+	case atom.Blockquote:
+		hc.flush()
+		hc.blockquote(n)
+	case atom.Hr:
+		hc.flush()
+		hc.add(Component{Role: RoleDivider})
+	case atom.Figure:
+		hc.flush()
+		hc.figure(n)
+	case atom.Img:
+		hc.flush()
+		hc.image(n, attr(n, "title"))
+	case atom.Iframe:
+		hc.flush()
+		hc.iframe(n)
+	case atom.Table:
+		hc.flush()
+		hc.add(Component{Role: RoleHtmlTable, HTML: hc.renderTable(n)})
+	default:
+		if containerHtmlElements[n.DataAtom] || containsBlock(n) {
+			hc.flush()
+			hc.children(n)
+			hc.flush()
+			return
+		}
+		hc.paragraph.WriteString(hc.renderInline(n))
+	}
+}
+
+//Turns the inline content collected so far into a body component
+func (hc *htmlConverter) flush() {
+	text := strings.TrimSpace(whitespace.ReplaceAllString(hc.paragraph.String(), " "))
+	hc.paragraph.Reset()
+	if len(text) > 0 && text != "<br/>" {
+		hc.text(RoleBody, text)
+	}
+}
+
+func (hc *htmlConverter) add(component Component) {
+	hc.Document.Components = append(hc.Document.Components, component)
+}
+
+func (hc *htmlConverter) text(role string, text string) {
+	hc.add(Component{Role: role, Text: text, Format: FormatHtml})
+}
+
+func (hc *htmlConverter) heading(n *html.Node) {
+	text := strings.TrimSpace(whitespace.ReplaceAllString(hc.renderChildren(n), " "))
+	if len(text) == 0 {
+		return
+	}
+	if n.DataAtom == atom.H1 && len(hc.options.Title) == 0 && len(hc.title) == 0 && len(hc.Document.Components) == 0 {
+		hc.title = strings.TrimSpace(textContent(n))
+		hc.text(RoleTitle, text)
+		return
+	}
+	hc.text("heading"+n.Data[1:], text)
+}
+
+func (hc *htmlConverter) blockquote(n *html.Node) {
+	class := " " + attr(n, "class") + " "
+	switch {
+	case strings.Contains(class, " twitter-tweet "):
+		if link := findLink(n, tweetPattern); len(link) > 0 {
+			hc.add(Component{Role: RoleTweet, URL: link})
+			return
+		}
+		hc.drop("tweet embed without a link to the tweet")
+	case strings.Contains(class, " instagram-media "):
+		link := attr(n, "data-instgrm-permalink")
+		if m := instagramPattern.FindString(link); len(m) > 0 {
+			hc.add(Component{Role: RoleInstagram, URL: m})
+			return
+		}
+		if link := findLink(n, instagramPattern); len(link) > 0 {
+			hc.add(Component{Role: RoleInstagram, URL: link})
+			return
+		}
+		hc.drop("Instagram embed without a link to the post")
+	default:
+		//Paragraphs of the quote are kept apart by line breaks
+		var parts []string
+		for child := n.FirstChild; child != nil; child = child.NextSibling {
+			var part string
+			if child.Type == html.ElementNode && child.DataAtom == atom.P {
+				part = hc.renderChildren(child)
+			} else {
+				part = hc.renderNode(child)
+			}
+			if part = strings.TrimSpace(whitespace.ReplaceAllString(part, " ")); len(part) > 0 {
+				parts = append(parts, part)
+			}
+		}
+		if text := strings.Join(parts, "<br/>"); len(text) > 0 {
+			hc.text(RoleQuote, text)
+		}
+	}
+}
+
+func (hc *htmlConverter) figure(n *html.Node) {
+	var caption string
+	if figcaption := findElement(n, atom.Figcaption); figcaption != nil {
+		caption = strings.TrimSpace(whitespace.ReplaceAllString(textContent(figcaption), " "))
+	}
+
+	found := false
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		if child.Type != html.ElementNode || child.DataAtom == atom.Figcaption {
+			continue
+		}
+		if img := findElement(child, atom.Img); img != nil {
+			hc.image(img, caption)
+			found = true
+		} else if iframe := findElement(child, atom.Iframe); iframe != nil {
+			hc.iframe(iframe)
+			found = true
+		} else if child.DataAtom == atom.Blockquote {
+			hc.blockquote(child)
+			found = true
+		}
+	}
+	if !found {
+		hc.drop("figure without an image, video or embed")
+	}
+}
+
+func (hc *htmlConverter) image(n *html.Node, caption string) {
+	src := attr(n, "src")
+	if len(caption) == 0 {
+		caption = attr(n, "alt")
+	}
+
+	switch {
+	case len(src) == 0:
+		hc.drop("image without a src")
+		return
+	case strings.HasPrefix(src, "data:"):
+		hc.drop("inline data: image")
+		return
+	case strings.HasPrefix(src, "//"):
+		src = "https:" + src
+	case len(hc.options.BaseURL) > 0 && !isRemoteURL(src):
+		resolved, ok := resolveURL(hc.options.BaseURL, src)
+		if !ok {
+			hc.drop("image %s that can't be resolved against %s", src, hc.options.BaseURL)
+			return
+		}
+		src = resolved
+	case !isRemoteURL(src):
+		p := filepath.FromSlash(src)
+		if !filepath.IsAbs(p) {
+			p = filepath.Join(hc.options.BaseDir, p)
+		}
+		src = hc.addAsset(p)
+	}
+	hc.add(Component{Role: RolePhoto, URL: src, Caption: caption})
+}
+
+func (hc *htmlConverter) iframe(n *html.Node) {
+	src := attr(n, "src")
+	if video := webVideoURL(src); len(video) > 0 {
+		hc.add(Component{Role: RoleEmbedWebVideo, URL: video})
+		return
+	}
+	hc.drop("iframe %s", src)
+}
+
+func (hc *htmlConverter) script(n *html.Node) {
+	src := attr(n, "src")
+	for _, loader := range embedLoaderScripts {
+		if strings.Contains(src, loader) {
+			return
+		}
+	}
+	hc.dropOnce("script", "<script> elements")
+}
+
+//Renders an element and its content with only the markup ANF html supports
+func (hc *htmlConverter) renderElement(n *html.Node) string {
+	var b strings.Builder
+	b.WriteString("<" + n.Data + ">")
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		if child.Type == html.ElementNode && (child.DataAtom == atom.Li || child.DataAtom == atom.Ul || child.DataAtom == atom.Ol) {
+			b.WriteString(hc.renderElement(child))
+		} else if child.Type == html.ElementNode && child.DataAtom == atom.P {
+			b.WriteString(hc.renderChildren(child))
+		} else {
+			b.WriteString(hc.renderNode(child))
+		}
+	}
+	b.WriteString("</" + n.Data + ">")
+	return b.String()
+}
+
+func (hc *htmlConverter) renderChildren(n *html.Node) string {
+	var b strings.Builder
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		b.WriteString(hc.renderNode(child))
+	}
+	return b.String()
+}
+
+func (hc *htmlConverter) renderNode(n *html.Node) string {
+	switch n.Type {
+	case html.TextNode:
+		return html.EscapeString(n.Data)
+	case html.ElementNode:
+		return hc.renderInline(n)
+	}
+	return ""
+}
+
+func (hc *htmlConverter) renderInline(n *html.Node) string {
+	attrs, ok := inlineHtmlElements[n.DataAtom]
+	if !ok {
+		switch n.DataAtom {
+		case atom.Script, atom.Style:
+			hc.dropOnce(n.Data, "<%s> elements", n.Data)
+			return ""
+		case atom.Img, atom.Iframe:
+			hc.drop("<%s> inside text %s", n.Data, attr(n, "src"))
+			return ""
+		}
+		//Keep the text of unsupported elements like <span> or <u>, just not the element itself
+		hc.dropOnce(n.Data, "<%s> markup, its text was kept", n.Data)
+		return hc.renderChildren(n)
+	}
+
+	if n.DataAtom == atom.Br {
+		return "<br/>"
+	}
+	var b strings.Builder
+	b.WriteString("<" + n.Data)
+	for _, name := range attrs {
+		if v := attr(n, name); len(v) > 0 {
+			fmt.Fprintf(&b, ` %s="%s"`, name, html.EscapeString(v))
+		}
+	}
+	b.WriteString(">" + hc.renderChildren(n) + "</" + n.Data + ">")
+	return b.String()
+}
+
+func (hc *htmlConverter) renderTable(n *html.Node) string {
+	var b strings.Builder
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		for child := n.FirstChild; child != nil; child = child.NextSibling {
+			if child.Type != html.ElementNode {
+				continue
+			}
+			switch child.DataAtom {
+			case atom.Thead, atom.Tbody, atom.Tfoot, atom.Tr:
+				b.WriteString("<" + child.Data + ">")
+				walk(child)
+				b.WriteString("</" + child.Data + ">")
+			case atom.Td, atom.Th:
+				b.WriteString("<" + child.Data + ">" + strings.TrimSpace(hc.renderChildren(child)) + "</" + child.Data + ">")
+			}
+		}
+	}
+	b.WriteString("<table>")
+	walk(n)
+	b.WriteString("</table>")
+	return b.String()
+}
+
+func (hc *htmlConverter) dropOnce(key string, format string, args ...interface{}) {
+	if hc.dropped[key] {
+		return
+	}
+	hc.dropped[key] = true
+	hc.drop(format, args...)
+}
+
+//Resolves ref against base, succeeding only when the result is an http or https URL
+func resolveURL(base string, ref string) (string, bool) {
+	b, err := url.Parse(base)
+	if err != nil {
+		return "", false
+	}
+	r, err := url.Parse(ref)
+	if err != nil {
+		return "", false
+	}
+	resolved := b.ResolveReference(r).String()
+	return resolved, isRemoteURL(resolved)
+}
+
+//Returns the URL to use for an embedwebvideo component, or "" if src isn't a YouTube or Vimeo video
+func webVideoURL(src string) string {
+	if strings.HasPrefix(src, "//") {
+		src = "https:" + src
+	}
+	u, err := url.Parse(src)
+	if err != nil {
+		return ""
+	}
+	host := strings.TrimPrefix(u.Host, "www.")
+	switch host {
+	case "youtube.com", "youtube-nocookie.com", "m.youtube.com":
+		if id := u.Query().Get("v"); len(id) > 0 {
+			return "https://www.youtube.com/embed/" + id
+		}
+		if m := youtubeIdPattern.FindStringSubmatch(u.Path); m != nil {
+			return "https://www.youtube.com/embed/" + m[1]
+		}
+	case "youtu.be":
+		return "https://www.youtube.com/embed/" + path.Base(u.Path)
+	case "vimeo.com", "player.vimeo.com":
+		if m := vimeoIdPattern.FindStringSubmatch(u.Path); m != nil {
+			return "https://player.vimeo.com/video/" + m[1]
+		}
+	}
+	return ""
+}
+
+func containsBlock(n *html.Node) bool {
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		if child.Type != html.ElementNode {
+			continue
+		}
+		if _, inline := inlineHtmlElements[child.DataAtom]; !inline && child.DataAtom != atom.Span && child.DataAtom != atom.U && child.DataAtom != atom.Small && child.DataAtom != atom.Mark {
+			return true
+		}
+		if containsBlock(child) {
+			return true
+		}
+	}
+	return false
+}
+
+func findElement(n *html.Node, a atom.Atom) *html.Node {
+	if n.Type == html.ElementNode && n.DataAtom == a {
+		return n
+	}
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		if found := findElement(child, a); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+//Returns the last link below n matching pattern, which for embeds is the permalink rather than a link in the text
+func findLink(n *html.Node, pattern *regexp.Regexp) string {
+	var link string
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode && n.DataAtom == atom.A {
+			if m := pattern.FindString(attr(n, "href")); len(m) > 0 {
+				link = m
+			}
+		}
+		for child := n.FirstChild; child != nil; child = child.NextSibling {
+			walk(child)
+		}
+	}
+	walk(n)
+	return link
+}
+
+func textContent(n *html.Node) string {
+	if n.Type == html.TextNode {
+		return n.Data
+	}
+	var b strings.Builder
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		b.WriteString(textContent(child))
+	}
+	return b.String()
+}
+
+func attr(n *html.Node, name string) string {
+	for _, a := range n.Attr {
+		if a.Key == name {
+			return a.Val
+		}
+	}
+	return ""
+}
@@ -0,0 +1,321 @@
+package anf
+
+import (
+	"fmt"
+	"html"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+type MarkdownOptions struct {
+	//Defaults to a slug of the title
+	Identifier string
+	//Defaults to the text of a leading level 1 heading, which then becomes the title component
+	Title    string
+	Language string
+	//The directory relative image paths are resolved against, usually the one containing the markdown file
+	BaseDir string
+}
+
+//Returned when a document has no title of its own and none was given in the options
+var ErrMissingTitle = errors.New("the document doesn't start with a level 1 heading to take the title from")
+
+var (
+	atxHeadingPattern  = regexp.MustCompile(`^ {0,3}(#{1,6})\s+(.*?)\s*#*\s*$`)
+	hrPattern          = regexp.MustCompile(`^ {0,3}(?:(?:-\s*){3,}|(?:\*\s*){3,}|(?:_\s*){3,})$`)
+	fencePattern       = regexp.MustCompile("^ {0,3}(```+|~~~+)")
+	listItemPattern    = regexp.MustCompile(`^(\s*)([-*+]|\d+[.)])\s+(.*)$`)
+	blockImagePattern  = regexp.MustCompile(`^!\[([^\]]*)\]\(\s*<?([^\s)>]+)>?(?:\s+"([^"]*)")?\s*\)$`)
+	inlineImagePattern = regexp.MustCompile(`!\[([^\]]*)\]\(([^)]*)\)`)
+	codeSpanPattern    = regexp.MustCompile("`+([^`]+)`+")
+	linkPattern        = regexp.MustCompile(`\[([^\]]+)\]\(\s*<?([^\s)>]+)>?(?:\s+&#34;[^)]*&#34;)?\s*\)`)
+	strongPattern      = regexp.MustCompile(`(\*\*|__)(\S(?:.*?\S)?)(\*\*|__)`)
+	emphasisPattern    = regexp.MustCompile(`(^|[^\w*])[*_](\S(?:.*?\S)?)[*_]`)
+	strikePattern      = regexp.MustCompile(`~~(\S(?:.*?\S)?)~~`)
+)
+
+//Converts a Markdown document into an ANF document. Headings, paragraphs, block quotes and rules map onto the
+//matching components with markdown formatted text, while lists and code, which ANF markdown can't express, are
+//converted to html formatted text. Images on a line of their own become photo components, and local ones are added
+//to the bundle as assets. Fails when there is no title
+func ConvertMarkdown(markdown []byte, options MarkdownOptions) (*Conversion, error) {
+	blocks := parseMarkdownBlocks(strings.Split(strings.Replace(string(markdown), "\r\n", "\n", -1), "\n"))
+
+	title := options.Title
+	if len(title) == 0 && len(blocks) > 0 && blocks[0].kind == blockHeading && blocks[0].level == 1 {
+		title = stripInlineMarkdown(blocks[0].text)
+	}
+	//The API refuses articles without a title
+	if len(strings.TrimSpace(title)) == 0 {
+		return nil, ErrMissingTitle
+	}
+
+	c := &Conversion{
+		Document: NewDocument(options.Identifier, title, options.Language),
+		Dropped:  []string{},
+	}
+
+	for i, b := range blocks {
+		if i == 0 && len(options.Title) == 0 && b.kind == blockHeading && b.level == 1 {
+			c.Document.Components = append(c.Document.Components, markdownTextComponent(RoleTitle, b.text))
+			continue
+		}
+		c.Document.Components = append(c.Document.Components, c.markdownBlockComponent(b, options))
+	}
+	return c, nil
+}
+
+func (c *Conversion) markdownBlockComponent(b markdownBlock, options MarkdownOptions) Component {
+	switch b.kind {
+	case blockHeading:
+		return markdownTextComponent(fmt.Sprintf("heading%d", b.level), b.text)
+	case blockRule:
+		return Component{Role: RoleDivider}
+	case blockCode:
+		return Component{
+			Role:   RoleBody,
+			Text:   "<pre><code>" + html.EscapeString(b.text) + "</code></pre>",
+			Format: FormatHtml,
+		}
+	case blockList:
+		return Component{
+			Role:   RoleBody,
+			Text:   c.markdownListHtml(b.items),
+			Format: FormatHtml,
+		}
+	case blockQuote:
+		return c.markdownTextBlock(RoleQuote, b.text)
+	case blockImage:
+		url := b.url
+		if !isRemoteURL(url) {
+			path := filepath.FromSlash(url)
+			if !filepath.IsAbs(path) {
+				path = filepath.Join(options.BaseDir, path)
+			}
+			url = c.addAsset(path)
+		}
+		caption := b.title
+		if len(caption) == 0 {
+			caption = b.text
+		}
+		return Component{Role: RolePhoto, URL: url, Caption: caption}
+	default:
+		return c.markdownTextBlock(RoleBody, b.text)
+	}
+}
+
+//Keeps text as markdown when ANF markdown can express it, and converts it to html otherwise
+func (c *Conversion) markdownTextBlock(role string, text string) Component {
+	for _, img := range inlineImagePattern.FindAllStringSubmatch(text, -1) {
+		c.drop("inline image %s, only images on a line of their own are converted", img[2])
+	}
+	text = inlineImagePattern.ReplaceAllString(text, "$1")
+	if codeSpanPattern.MatchString(text) {
+		return Component{Role: role, Text: inlineMarkdownToHtml(text), Format: FormatHtml}
+	}
+	return markdownTextComponent(role, text)
+}
+
+func markdownTextComponent(role string, text string) Component {
+	return Component{Role: role, Text: text, Format: FormatMarkdown}
+}
+
+func (c *Conversion) markdownListHtml(items []markdownListItem) string {
+	var b strings.Builder
+	var open []string
+	var indents []int
+	closeList := func() {
+		b.WriteString("</li></" + open[len(open)-1] + ">")
+		open = open[:len(open)-1]
+		indents = indents[:len(indents)-1]
+	}
+
+	for _, item := range items {
+		tag := "ul"
+		if item.ordered {
+			tag = "ol"
+		}
+		for len(open) > 0 && item.indent < indents[len(indents)-1] {
+			closeList()
+		}
+		if len(open) > 0 && item.indent == indents[len(indents)-1] && open[len(open)-1] != tag {
+			closeList()
+		}
+
+		if len(open) > 0 && item.indent == indents[len(indents)-1] {
+			b.WriteString("</li>")
+		} else {
+			b.WriteString("<" + tag + ">")
+			open = append(open, tag)
+			indents = append(indents, item.indent)
+		}
+		for _, img := range inlineImagePattern.FindAllStringSubmatch(item.text, -1) {
+			c.drop("inline image %s in a list item", img[2])
+		}
+		text := inlineImagePattern.ReplaceAllString(item.text, "$1")
+		b.WriteString("<li>" + inlineMarkdownToHtml(text))
+	}
+	for len(open) > 0 {
+		closeList()
+	}
+	return b.String()
+}
+
+//Converts the inline markup ANF html supports: code, links, strong, emphasis and strikethrough
+func inlineMarkdownToHtml(text string) string {
+	var codeSpans []string
+	text = codeSpanPattern.ReplaceAllStringFunc(text, func(span string) string {
+		codeSpans = append(codeSpans, strings.TrimSpace(strings.Trim(span, "`")))
+		return fmt.Sprintf("\x00%d\x00", len(codeSpans)-1)
+	})
+
+	text = html.EscapeString(text)
+	text = linkPattern.ReplaceAllString(text, `<a href="$2">$1</a>`)
+	text = strongPattern.ReplaceAllString(text, "<strong>$2</strong>")
+	text = emphasisPattern.ReplaceAllString(text, "$1<em>$2</em>")
+	text = strikePattern.ReplaceAllString(text, "<del>$1</del>")
+
+	for i, code := range codeSpans {
+		text = strings.Replace(text, fmt.Sprintf("\x00%d\x00", i), "<code>"+html.EscapeString(code)+"</code>", 1)
+	}
+	return text
+}
+
+func stripInlineMarkdown(text string) string {
+	text = linkPattern.ReplaceAllString(text, "$1")
+	text = strongPattern.ReplaceAllString(text, "$2")
+	text = emphasisPattern.ReplaceAllString(text, "$1$2")
+	return strings.Replace(text, "`", "", -1)
+}
+
+type markdownBlockKind int
+
+const (
+	blockParagraph markdownBlockKind = iota
+	blockHeading
+	blockRule
+	blockCode
+	blockList
+	blockQuote
+	blockImage
+)
+
+type markdownBlock struct {
+	kind  markdownBlockKind
+	level int
+	text  string
+	url   string
+	title string
+	items []markdownListItem
+}
+
+type markdownListItem struct {
+	indent  int
+	ordered bool
+	text    string
+}
+
+func parseMarkdownBlocks(lines []string) []markdownBlock {
+	var blocks []markdownBlock
+	var paragraph []string
+
+	flush := func() {
+		if len(paragraph) == 0 {
+			return
+		}
+		text := strings.Join(paragraph, "\n")
+		paragraph = nil
+		if m := blockImagePattern.FindStringSubmatch(text); m != nil {
+			blocks = append(blocks, markdownBlock{kind: blockImage, text: m[1], url: m[2], title: m[3]})
+			return
+		}
+		blocks = append(blocks, markdownBlock{kind: blockParagraph, text: text})
+	}
+
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		trimmed := strings.TrimSpace(line)
+
+		switch {
+		case len(trimmed) == 0:
+			flush()
+
+		case fencePattern.MatchString(line):
+			flush()
+			fence := fencePattern.FindStringSubmatch(line)[1]
+			var code []string
+			for i++; i < len(lines) && !strings.HasPrefix(strings.TrimSpace(lines[i]), fence); i++ {
+				code = append(code, lines[i])
+			}
+			blocks = append(blocks, markdownBlock{kind: blockCode, text: strings.Join(code, "\n")})
+
+		case atxHeadingPattern.MatchString(line):
+			flush()
+			m := atxHeadingPattern.FindStringSubmatch(line)
+			blocks = append(blocks, markdownBlock{kind: blockHeading, level: len(m[1]), text: m[2]})
+
+		case len(paragraph) > 0 && (strings.Trim(trimmed, "=") == "" || strings.Trim(trimmed, "-") == ""):
+			level := 1
+			if trimmed[0] == '-' {
+				level = 2
+			}
+			blocks = append(blocks, markdownBlock{kind: blockHeading, level: level, text: strings.Join(paragraph, " ")})
+			paragraph = nil
+
+		case hrPattern.MatchString(line):
+			flush()
+			blocks = append(blocks, markdownBlock{kind: blockRule})
+
+		case strings.HasPrefix(trimmed, ">"):
+			flush()
+			var quote []string
+			for ; i < len(lines) && strings.HasPrefix(strings.TrimSpace(lines[i]), ">"); i++ {
+				quote = append(quote, strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(lines[i]), ">")))
+			}
+			i--
+			blocks = append(blocks, markdownBlock{kind: blockQuote, text: strings.TrimSpace(strings.Join(quote, "\n"))})
+
+		case listItemPattern.MatchString(line) && (len(paragraph) == 0 || !startsWithNumber(trimmed)):
+			flush()
+			var items []markdownListItem
+			for ; i < len(lines); i++ {
+				if m := listItemPattern.FindStringSubmatch(lines[i]); m != nil {
+					items = append(items, markdownListItem{
+						indent:  len(strings.Replace(m[1], "\t", "    ", -1)),
+						ordered: startsWithNumber(m[2]),
+						text:    m[3],
+					})
+					continue
+				}
+				//Indented lines continue the previous item, anything else ends the list
+				if len(items) > 0 && len(strings.TrimSpace(lines[i])) > 0 && strings.HasPrefix(lines[i], "  ") {
+					items[len(items)-1].text += " " + strings.TrimSpace(lines[i])
+					continue
+				}
+				break
+			}
+			i--
+			blocks = append(blocks, markdownBlock{kind: blockList, items: items})
+
+		case len(paragraph) == 0 && (strings.HasPrefix(line, "    ") || strings.HasPrefix(line, "\t")):
+			var code []string
+			for ; i < len(lines) && (strings.HasPrefix(lines[i], "    ") || strings.HasPrefix(lines[i], "\t") || len(strings.TrimSpace(lines[i])) == 0); i++ {
+				code = append(code, strings.TrimPrefix(strings.TrimPrefix(lines[i], "\t"), "    "))
+			}
+			i--
+			blocks = append(blocks, markdownBlock{kind: blockCode, text: strings.TrimRight(strings.Join(code, "\n"), "\n")})
+
+		default:
+			paragraph = append(paragraph, trimmed)
+		}
+	}
+	flush()
+	return blocks
+}
+
+func startsWithNumber(s string) bool {
+	return len(s) > 0 && s[0] >= '0' && s[0] <= '9'
+}
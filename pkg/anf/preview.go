@@ -0,0 +1,103 @@
+package anf
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"html"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	previewBundlePath  = "/bundle/"
+	previewVersionPath = "/_preview/version"
+)
+
+//Polls the version of the bundle and reloads the page once it changes
+const previewReloadScript = `<script>
+(function() {
+	var version = %q;
+	setInterval(function() {
+		fetch(%q, {cache: "no-store"}).then(function(r) { return r.text(); }).then(function(v) {
+			if (v !== version) { location.reload(); }
+		}).catch(function() {});
+	}, 1000);
+})();
+</script>`
+
+//Serves an HTML preview of the bundle in Dir at /, with the bundle files under /bundle/. The page reloads itself
+//whenever a file in the bundle changes, and shows the error instead when article.json can't be rendered
+type PreviewHandler struct {
+	Dir string
+}
+
+func (p *PreviewHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case r.URL.Path == previewVersionPath:
+		version, err := BundleFingerprint(p.Dir)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Cache-Control", "no-store")
+		fmt.Fprint(w, version)
+	case strings.HasPrefix(r.URL.Path, previewBundlePath):
+		name := path.Clean("/" + strings.TrimPrefix(r.URL.Path, previewBundlePath))
+		http.ServeFile(w, r, filepath.Join(p.Dir, filepath.FromSlash(name)))
+	case r.URL.Path == "/":
+		p.servePage(w)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (p *PreviewHandler) servePage(w http.ResponseWriter) {
+	//Taken before reading so a change made while rendering still triggers a reload
+	version, err := BundleFingerprint(p.Dir)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	reload := fmt.Sprintf(previewReloadScript, version, previewVersionPath)
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	article, err := ioutil.ReadFile(filepath.Join(p.Dir, "article.json"))
+	if err == nil {
+		var page []byte
+		if page, err = RenderHtml(article, RenderOptions{BundleURL: previewBundlePath, Footer: reload}); err == nil {
+			w.Write(page)
+			return
+		}
+	}
+	w.WriteHeader(http.StatusUnprocessableEntity)
+	fmt.Fprintf(w, "<!DOCTYPE html>\n<html>\n<body>\n<pre>%s</pre>\n%s\n</body>\n</html>\n", html.EscapeString(err.Error()), reload)
+}
+
+//Returns a value that changes whenever a file in the bundle is added, removed or modified
+func BundleFingerprint(dir string) (string, error) {
+	h := sha256.New()
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(h, "%s\x00%d\x00%d\x00", filepath.ToSlash(rel), info.Size(), info.ModTime().UnixNano())
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,549 @@
+package anf
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html"
+	"strings"
+	"unicode"
+
+	"github.com/pkg/errors"
+)
+
+type RenderOptions struct {
+	//Replaces bundle:// in asset URLs, e.g. "/bundle/". When empty asset names are left relative, so the page works
+	//when written next to the bundle files
+	BundleURL string
+	//Markup added at the end of the body, such as a live reload script
+	Footer string
+}
+
+//The parts of an article.json the renderer understands. Layouts, styles and text styles can be given inline or as the
+//name of a document level one, so they are kept raw until resolved
+type renderDocument struct {
+	Title               string                     `json:"title"`
+	Language            string                     `json:"language"`
+	Layout              Layout                     `json:"layout"`
+	Components          []renderComponent          `json:"components"`
+	ComponentLayouts    map[string]renderLayout    `json:"componentLayouts"`
+	ComponentStyles     map[string]renderStyle     `json:"componentStyles"`
+	ComponentTextStyles map[string]renderTextStyle `json:"componentTextStyles"`
+	DocumentStyle       *DocumentStyle             `json:"documentStyle"`
+}
+
+type renderComponent struct {
+	Role       string            `json:"role"`
+	Text       string            `json:"text"`
+	Format     string            `json:"format"`
+	URL        string            `json:"URL"`
+	HTML       string            `json:"html"`
+	Caption    json.RawMessage   `json:"caption"`
+	Items      []renderItem      `json:"items"`
+	Layout     json.RawMessage   `json:"layout"`
+	Style      json.RawMessage   `json:"style"`
+	TextStyle  json.RawMessage   `json:"textStyle"`
+	Components []renderComponent `json:"components"`
+}
+
+type renderItem struct {
+	URL     string          `json:"URL"`
+	Caption json.RawMessage `json:"caption"`
+}
+
+type renderLayout struct {
+	ColumnStart          *int            `json:"columnStart"`
+	ColumnSpan           *int            `json:"columnSpan"`
+	Margin               json.RawMessage `json:"margin"`
+	IgnoreDocumentMargin json.RawMessage `json:"ignoreDocumentMargin"`
+	MinimumHeight        json.RawMessage `json:"minimumHeight"`
+}
+
+type renderStyle struct {
+	BackgroundColor string   `json:"backgroundColor"`
+	Opacity         *float64 `json:"opacity"`
+	Border          *struct {
+		All *struct {
+			Color string `json:"color"`
+			Width int    `json:"width"`
+			Style string `json:"style"`
+		} `json:"all"`
+	} `json:"border"`
+}
+
+type renderTextStyle struct {
+	FontName               string      `json:"fontName"`
+	FontFamily             string      `json:"fontFamily"`
+	FontSize               int         `json:"fontSize"`
+	LineHeight             int         `json:"lineHeight"`
+	TextColor              string      `json:"textColor"`
+	BackgroundColor        string      `json:"backgroundColor"`
+	TextAlignment          string      `json:"textAlignment"`
+	TextTransform          string      `json:"textTransform"`
+	FontStyle              string      `json:"fontStyle"`
+	FontWeight             interface{} `json:"fontWeight"`
+	ParagraphSpacingBefore int         `json:"paragraphSpacingBefore"`
+	ParagraphSpacingAfter  int         `json:"paragraphSpacingAfter"`
+}
+
+//Roughly what Apple News uses when a document doesn't style a role itself
+var defaultRenderTextStyles = map[string]renderTextStyle{
+	"":          {FontName: "HelveticaNeue", FontSize: 16, LineHeight: 24, TextColor: "#000000"},
+	RoleTitle:   {FontName: "HelveticaNeue-Bold", FontSize: 36, LineHeight: 42},
+	"subtitle":  {FontSize: 22, LineHeight: 28},
+	"intro":     {FontSize: 20, LineHeight: 28},
+	RoleByline:  {FontSize: 13, LineHeight: 18, TextColor: "#6d6d6d"},
+	RoleCaption: {FontSize: 13, LineHeight: 18, TextColor: "#6d6d6d"},
+	RoleQuote:   {FontName: "Georgia-Italic", FontSize: 22, LineHeight: 30},
+	"pullquote": {FontName: "HelveticaNeue-Bold", FontSize: 28, LineHeight: 34},
+	"heading":   {FontName: "HelveticaNeue-Bold", FontSize: 26, LineHeight: 32},
+	"heading1":  {FontName: "HelveticaNeue-Bold", FontSize: 32, LineHeight: 38},
+	"heading2":  {FontName: "HelveticaNeue-Bold", FontSize: 26, LineHeight: 32},
+	"heading3":  {FontName: "HelveticaNeue-Bold", FontSize: 22, LineHeight: 28},
+	"heading4":  {FontName: "HelveticaNeue-Bold", FontSize: 20, LineHeight: 26},
+	"heading5":  {FontName: "HelveticaNeue-Bold", FontSize: 18, LineHeight: 24},
+	"heading6":  {FontName: "HelveticaNeue-Bold", FontSize: 16, LineHeight: 22},
+}
+
+const renderBaseCss = `
+html, body { margin: 0; padding: 0; }
+body { background: #ffffff; }
+.anf-article { margin: 0 auto; display: grid; box-sizing: border-box; overflow: hidden; }
+.anf-component { box-sizing: border-box; min-width: 0; }
+.anf-text p { margin: 0; }
+.anf-text a { color: inherit; }
+.anf-plain { white-space: pre-wrap; }
+.anf-component img, .anf-component video, .anf-component iframe { display: block; width: 100%; border: 0; }
+.anf-component iframe { aspect-ratio: 16 / 9; height: auto; }
+.anf-component figure { margin: 0; }
+.anf-component hr { border: 0; border-top: 1px solid #d1d1d1; margin: 0; }
+.anf-gallery { display: grid; grid-template-columns: repeat(auto-fill, minmax(160px, 1fr)); gap: 4px; }
+.anf-social, .anf-unsupported { border: 1px dashed #b0b0b0; padding: 12px; font: 13px/18px -apple-system, Helvetica, sans-serif; color: #6d6d6d; }
+.anf-table table { border-collapse: collapse; width: 100%; }
+.anf-table td, .anf-table th { border: 1px solid #d1d1d1; padding: 4px 8px; }
+`
+
+type renderer struct {
+	doc     renderDocument
+	options RenderOptions
+}
+
+//Renders an article.json into a standalone HTML page that approximates how Apple News lays it out. Column layouts,
+//margins, component styles, component text styles and the document style are honored, photos and galleries show their
+//images, and components without an HTML equivalent, such as social embeds, are shown as placeholders
+func RenderHtml(article []byte, options RenderOptions) ([]byte, error) {
+	r := &renderer{options: options}
+	if err := json.Unmarshal(article, &r.doc); err != nil {
+		return nil, errors.Wrap(err, "parsing article.json")
+	}
+	if r.doc.Layout.Columns <= 0 {
+		return nil, errors.New("article.json has no layout columns")
+	}
+
+	var b strings.Builder
+	b.WriteString("<!DOCTYPE html>\n<html lang=\"" + html.EscapeString(r.doc.Language) + "\">\n<head>\n<meta charset=\"utf-8\">\n")
+	b.WriteString("<title>" + html.EscapeString(r.doc.Title) + "</title>\n<style>" + renderBaseCss + "</style>\n</head>\n")
+	if r.doc.DocumentStyle != nil && len(r.doc.DocumentStyle.BackgroundColor) > 0 {
+		b.WriteString("<body style=\"background:" + html.EscapeString(cssValue(r.doc.DocumentStyle.BackgroundColor)) + "\">\n")
+	} else {
+		b.WriteString("<body>\n")
+	}
+
+	l := r.doc.Layout
+	fmt.Fprintf(&b, "<div class=\"anf-article\" style=\"width:%dpx;grid-template-columns:repeat(%d,minmax(0,1fr));column-gap:%dpx;padding:0 %dpx\">\n",
+		l.Width, l.Columns, l.Gutter, l.Margin)
+	for i, c := range r.doc.Components {
+		r.component(&b, c, i+1)
+	}
+	b.WriteString("</div>\n" + options.Footer + "\n</body>\n</html>\n")
+	return []byte(b.String()), nil
+}
+
+//Renders a component. Top level components are placed on the document grid in row, nested ones (row 0) stack
+func (r *renderer) component(b *strings.Builder, c renderComponent, row int) {
+	var css []string
+	layout := r.layout(c.Layout)
+	if row > 0 {
+		start := 0
+		if layout.ColumnStart != nil {
+			start = *layout.ColumnStart
+		}
+		span := r.doc.Layout.Columns - start
+		if layout.ColumnSpan != nil {
+			span = *layout.ColumnSpan
+		}
+		css = append(css, fmt.Sprintf("grid-row:%d", row), fmt.Sprintf("grid-column:%d / span %d", start+1, span))
+		left, right := ignoredMargins(layout.IgnoreDocumentMargin)
+		if left {
+			css = append(css, fmt.Sprintf("margin-left:-%dpx", r.doc.Layout.Margin))
+		}
+		if right {
+			css = append(css, fmt.Sprintf("margin-right:-%dpx", r.doc.Layout.Margin))
+		}
+	}
+	top, bottom := layoutMargins(layout.Margin)
+	if top != 0 {
+		css = append(css, fmt.Sprintf("margin-top:%dpx", top))
+	}
+	if bottom != 0 {
+		css = append(css, fmt.Sprintf("margin-bottom:%dpx", bottom))
+	}
+	if height := dimension(layout.MinimumHeight); len(height) > 0 {
+		css = append(css, "min-height:"+height)
+	}
+	css = append(css, r.style(c.Style)...)
+
+	fmt.Fprintf(b, "<div class=\"anf-component anf-%s\" style=\"%s\">", html.EscapeString(c.Role), html.EscapeString(strings.Join(css, ";")))
+	r.content(b, c)
+	b.WriteString("</div>\n")
+}
+
+func (r *renderer) content(b *strings.Builder, c renderComponent) {
+	switch c.Role {
+	case "container", "section", "chapter", "header", "aside", "collection", "article_link":
+		for _, child := range c.Components {
+			r.component(b, child, 0)
+		}
+	case RolePhoto, "image", RoleFigure, "portrait", "logo":
+		b.WriteString("<figure><img src=\"" + html.EscapeString(r.assetURL(c.URL)) + "\" alt=\"\">")
+		if caption := captionText(c.Caption); len(caption) > 0 {
+			b.WriteString("<figcaption class=\"anf-text\" style=\"" + r.textCss(RoleCaption, nil) + "\">" + html.EscapeString(caption) + "</figcaption>")
+		}
+		b.WriteString("</figure>")
+	case "gallery", "mosaic":
+		b.WriteString("<div class=\"anf-gallery\">")
+		for _, item := range c.Items {
+			b.WriteString("<img src=\"" + html.EscapeString(r.assetURL(item.URL)) + "\" alt=\"" + html.EscapeString(captionText(item.Caption)) + "\">")
+		}
+		b.WriteString("</div>")
+	case RoleDivider:
+		b.WriteString("<hr>")
+	case RoleEmbedWebVideo:
+		b.WriteString("<iframe src=\"" + html.EscapeString(c.URL) + "\" allowfullscreen></iframe>")
+	case "video", "audio", "music":
+		tag := "video"
+		if c.Role != "video" {
+			tag = "audio"
+		}
+		b.WriteString("<" + tag + " src=\"" + html.EscapeString(r.assetURL(c.URL)) + "\" controls></" + tag + ">")
+	case RoleTweet, RoleInstagram, RoleFacebook, "tiktok":
+		b.WriteString("<div class=\"anf-social\">" + html.EscapeString(c.Role) + ": <a href=\"" + html.EscapeString(c.URL) + "\">" + html.EscapeString(c.URL) + "</a></div>")
+	case RoleHtmlTable:
+		b.WriteString("<div class=\"anf-table anf-text\" style=\"" + r.textCss(c.Role, c.TextStyle) + "\">" + c.HTML + "</div>")
+	default:
+		if len(c.Text) == 0 && len(c.Components) == 0 {
+			b.WriteString("<div class=\"anf-unsupported\">" + html.EscapeString(c.Role) + " isn't previewed</div>")
+			return
+		}
+		if len(c.Text) > 0 {
+			r.text(b, c)
+		}
+		for _, child := range c.Components {
+			r.component(b, child, 0)
+		}
+	}
+}
+
+func (r *renderer) text(b *strings.Builder, c renderComponent) {
+	style := r.textStyle(c.Role, c.TextStyle)
+	css := r.textCss(c.Role, c.TextStyle)
+	switch c.Format {
+	case FormatHtml:
+		b.WriteString("<div class=\"anf-text\" style=\"" + css + "\">" + c.Text + "</div>")
+	case FormatMarkdown:
+		b.WriteString("<div class=\"anf-text\" style=\"" + css + "\">")
+		//Apple News separates paragraphs by the paragraph spacing, or a blank line when there is none
+		spacing := style.ParagraphSpacingBefore + style.ParagraphSpacingAfter
+		if spacing == 0 {
+			spacing = style.LineHeight
+		}
+		for i, p := range strings.Split(strings.TrimSpace(c.Text), "\n\n") {
+			pCss := ""
+			if i > 0 {
+				pCss = fmt.Sprintf("margin-top:%dpx", spacing)
+			}
+			b.WriteString("<p style=\"" + pCss + "\">" + strings.Replace(inlineMarkdownToHtml(p), "\n", "<br>", -1) + "</p>")
+		}
+		b.WriteString("</div>")
+	default:
+		b.WriteString("<div class=\"anf-text anf-plain\" style=\"" + css + "\">" + html.EscapeString(c.Text) + "</div>")
+	}
+}
+
+func (r *renderer) assetURL(url string) string {
+	if strings.HasPrefix(url, "bundle://") {
+		return r.options.BundleURL + strings.TrimPrefix(url, "bundle://")
+	}
+	return url
+}
+
+func (r *renderer) layout(ref json.RawMessage) renderLayout {
+	var layout renderLayout
+	if name, ok := styleName(ref); ok {
+		return r.doc.ComponentLayouts[name]
+	}
+	if len(ref) > 0 {
+		json.Unmarshal(ref, &layout)
+	}
+	return layout
+}
+
+func (r *renderer) style(ref json.RawMessage) []string {
+	var style renderStyle
+	if name, ok := styleName(ref); ok {
+		style = r.doc.ComponentStyles[name]
+	} else if len(ref) > 0 {
+		json.Unmarshal(ref, &style)
+	}
+
+	var css []string
+	if len(style.BackgroundColor) > 0 {
+		css = append(css, "background-color:"+cssValue(style.BackgroundColor))
+	}
+	if style.Opacity != nil {
+		css = append(css, fmt.Sprintf("opacity:%g", *style.Opacity))
+	}
+	if style.Border != nil && style.Border.All != nil {
+		border := style.Border.All
+		if len(border.Style) == 0 {
+			border.Style = "solid"
+		}
+		css = append(css, fmt.Sprintf("border:%dpx %s %s", border.Width, cssValue(border.Style), cssValue(border.Color)))
+	}
+	return css
+}
+
+//Resolves the text style of a role the way Apple News cascades it: the default style, then the role's default style,
+//then the component's own
+func (r *renderer) textStyle(role string, ref json.RawMessage) renderTextStyle {
+	style := defaultRenderTextStyles[""].merge(defaultRenderTextStyles[role])
+	style = style.merge(r.doc.ComponentTextStyles["default"])
+	style = style.merge(r.doc.ComponentTextStyles["default-"+role])
+	if name, ok := styleName(ref); ok {
+		style = style.merge(r.doc.ComponentTextStyles[name])
+	} else if len(ref) > 0 {
+		var inline renderTextStyle
+		json.Unmarshal(ref, &inline)
+		style = style.merge(inline)
+	}
+	return style
+}
+
+func (r *renderer) textCss(role string, ref json.RawMessage) string {
+	s := r.textStyle(role, ref)
+	family, weight, italic := fontCss(s.FontName)
+	if len(s.FontFamily) > 0 {
+		family = "\"" + s.FontFamily + "\", " + genericFontFamily(s.FontFamily)
+	}
+	switch w := s.FontWeight.(type) {
+	case float64:
+		weight = fmt.Sprintf("%g", w)
+	case string:
+		weight = w
+	}
+	if len(s.FontStyle) > 0 {
+		italic = s.FontStyle == "italic" || s.FontStyle == "oblique"
+	}
+
+	css := []string{"font-family:" + cssValue(family), "font-weight:" + cssValue(weight)}
+	if italic {
+		css = append(css, "font-style:italic")
+	}
+	if s.FontSize > 0 {
+		css = append(css, fmt.Sprintf("font-size:%dpx", s.FontSize))
+	}
+	if s.LineHeight > 0 {
+		css = append(css, fmt.Sprintf("line-height:%dpx", s.LineHeight))
+	}
+	for property, value := range map[string]string{
+		"color":            s.TextColor,
+		"background-color": s.BackgroundColor,
+		"text-align":       s.TextAlignment,
+		"text-transform":   s.TextTransform,
+	} {
+		if len(value) > 0 {
+			css = append(css, property+":"+cssValue(value))
+		}
+	}
+	return html.EscapeString(strings.Join(css, ";"))
+}
+
+func (s renderTextStyle) merge(o renderTextStyle) renderTextStyle {
+	if len(o.FontName) > 0 {
+		s.FontName = o.FontName
+		s.FontFamily = ""
+	}
+	if len(o.FontFamily) > 0 {
+		s.FontFamily = o.FontFamily
+	}
+	if o.FontSize > 0 {
+		s.FontSize = o.FontSize
+	}
+	if o.LineHeight > 0 {
+		s.LineHeight = o.LineHeight
+	}
+	if len(o.TextColor) > 0 {
+		s.TextColor = o.TextColor
+	}
+	if len(o.BackgroundColor) > 0 {
+		s.BackgroundColor = o.BackgroundColor
+	}
+	if len(o.TextAlignment) > 0 {
+		s.TextAlignment = o.TextAlignment
+	}
+	if len(o.TextTransform) > 0 {
+		s.TextTransform = o.TextTransform
+	}
+	if len(o.FontStyle) > 0 {
+		s.FontStyle = o.FontStyle
+	}
+	if o.FontWeight != nil {
+		s.FontWeight = o.FontWeight
+	}
+	if o.ParagraphSpacingBefore > 0 {
+		s.ParagraphSpacingBefore = o.ParagraphSpacingBefore
+	}
+	if o.ParagraphSpacingAfter > 0 {
+		s.ParagraphSpacingAfter = o.ParagraphSpacingAfter
+	}
+	return s
+}
+
+//Maps a PostScript font name like HelveticaNeue-BoldItalic onto a CSS family, weight and style. The PostScript name
+//comes first so the exact font is used when it is installed
+func fontCss(fontName string) (family string, weight string, italic bool) {
+	parts := strings.SplitN(fontName, "-", 2)
+	family = fmt.Sprintf("\"%s\", \"%s\", %s", fontName, splitCamelCase(parts[0]), genericFontFamily(fontName))
+
+	weight = "400"
+	if len(parts) < 2 {
+		return family, weight, false
+	}
+	variant := strings.ToLower(parts[1])
+	for _, w := range []struct{ name, weight string }{
+		{"ultralight", "200"}, {"thin", "100"}, {"light", "300"}, {"medium", "500"},
+		{"semibold", "600"}, {"demibold", "600"}, {"bold", "700"}, {"heavy", "800"}, {"black", "900"},
+	} {
+		if strings.Contains(variant, w.name) {
+			weight = w.weight
+			break
+		}
+	}
+	return family, weight, strings.Contains(variant, "italic") || strings.Contains(variant, "oblique")
+}
+
+func genericFontFamily(name string) string {
+	lower := strings.ToLower(name)
+	for _, mono := range []string{"mono", "menlo", "courier"} {
+		if strings.Contains(lower, mono) {
+			return "monospace"
+		}
+	}
+	if strings.Contains(lower, "sans") {
+		return "sans-serif"
+	}
+	for _, serif := range []string{"serif", "georgia", "times", "baskerville", "garamond", "iowan", "palatino", "charter", "didot"} {
+		if strings.Contains(lower, serif) {
+			return "serif"
+		}
+	}
+	return "sans-serif"
+}
+
+func splitCamelCase(s string) string {
+	var b strings.Builder
+	runes := []rune(s)
+	for i, c := range runes {
+		if i > 0 && unicode.IsUpper(c) && (unicode.IsLower(runes[i-1]) || (i+1 < len(runes) && unicode.IsLower(runes[i+1]))) {
+			b.WriteRune(' ')
+		}
+		b.WriteRune(c)
+	}
+	return b.String()
+}
+
+//Returns the name when a layout, style or text style is referenced by name rather than given inline
+func styleName(ref json.RawMessage) (string, bool) {
+	var name string
+	if len(ref) == 0 || ref[0] != '"' {
+		return "", false
+	}
+	return name, json.Unmarshal(ref, &name) == nil
+}
+
+//Captions are either plain strings or caption descriptors with a text property
+func captionText(caption json.RawMessage) string {
+	if len(caption) == 0 {
+		return ""
+	}
+	var text string
+	if json.Unmarshal(caption, &text) == nil {
+		return text
+	}
+	var descriptor struct {
+		Text string `json:"text"`
+	}
+	json.Unmarshal(caption, &descriptor)
+	return descriptor.Text
+}
+
+//Margins are either one number for both top and bottom, or an object with either
+func layoutMargins(margin json.RawMessage) (int, int) {
+	if len(margin) == 0 {
+		return 0, 0
+	}
+	var both int
+	if json.Unmarshal(margin, &both) == nil {
+		return both, both
+	}
+	var m struct {
+		Top    int `json:"top"`
+		Bottom int `json:"bottom"`
+	}
+	json.Unmarshal(margin, &m)
+	return m.Top, m.Bottom
+}
+
+func ignoredMargins(ignore json.RawMessage) (left bool, right bool) {
+	var all bool
+	if json.Unmarshal(ignore, &all) == nil {
+		return all, all
+	}
+	var side string
+	json.Unmarshal(ignore, &side)
+	return side == "left" || side == "both", side == "right" || side == "both"
+}
+
+//Converts an ANF supported dimension such as 300, "300pt" or "50vh" to CSS. Units relative to the component or
+//parent width are approximated with a viewport width
+func dimension(value json.RawMessage) string {
+	if len(value) == 0 {
+		return ""
+	}
+	var points float64
+	if json.Unmarshal(value, &points) == nil {
+		return fmt.Sprintf("%gpx", points)
+	}
+	var s string
+	json.Unmarshal(value, &s)
+	for _, unit := range []struct{ anf, css string }{{"pt", "px"}, {"vh", "vh"}, {"vw", "vw"}, {"vmin", "vmin"}, {"vmax", "vmax"}, {"cw", "vw"}, {"pw", "vw"}} {
+		if strings.HasSuffix(s, unit.anf) {
+			var n float64
+			if _, err := fmt.Sscanf(strings.TrimSuffix(s, unit.anf), "%g", &n); err == nil {
+				return fmt.Sprintf("%g%s", n, unit.css)
+			}
+		}
+	}
+	return ""
+}
+
+//Keeps document supplied values from breaking out of the declaration they are written to. Attributes are escaped on
+//top of this
+func cssValue(s string) string {
+	return string(bytes.Map(func(r rune) rune {
+		if r == ';' || r == '{' || r == '}' {
+			return -1
+		}
+		return r
+	}, []byte(s)))
+}
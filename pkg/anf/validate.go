@@ -0,0 +1,103 @@
+package anf
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/sdotz/apple-news-push-api/pkg/api"
+)
+
+//Lists everything wrong with a bundle
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return "invalid bundle: " + strings.Join(e.Problems, "; ")
+}
+
+//Checks a bundle for the mistakes that would make the API reject it: article.json that doesn't parse or misses
+//required properties, components without a role, references to undefined layouts, styles or text styles, and
+//bundle:// files that don't exist. Returns a *ValidationError listing all of them
+func ValidateBundle(dir string) error {
+	article, err := ioutil.ReadFile(filepath.Join(dir, "article.json"))
+	if err != nil {
+		return err
+	}
+
+	var problems []string
+	var doc struct {
+		renderDocument
+		Version    string `json:"version"`
+		Identifier string `json:"identifier"`
+	}
+	if err := json.Unmarshal(article, &doc); err != nil {
+		return &ValidationError{Problems: []string{"article.json: " + err.Error()}}
+	}
+	for property, value := range map[string]string{
+		"version":    doc.Version,
+		"identifier": doc.Identifier,
+		"title":      doc.Title,
+		"language":   doc.Language,
+	} {
+		if len(value) == 0 {
+			problems = append(problems, fmt.Sprintf("%s is required", property))
+		}
+	}
+	if doc.Layout.Columns <= 0 || doc.Layout.Width <= 0 {
+		problems = append(problems, "layout needs columns and width")
+	}
+	if len(doc.Components) == 0 {
+		problems = append(problems, "components can't be empty")
+	}
+	problems = append(problems, validateComponents(&doc.renderDocument, doc.Components, "components")...)
+
+	//The same scan uploads use, so what passes here is what gets uploaded
+	references, err := api.ScanBundleReferences(article)
+	if err != nil {
+		problems = append(problems, err.Error())
+	}
+	for _, ref := range references {
+		if _, err := os.Stat(filepath.Join(dir, filepath.FromSlash(ref.Name))); err != nil {
+			problems = append(problems, fmt.Sprintf("bundle://%s doesn't exist", ref.Name))
+		}
+	}
+
+	sort.Strings(problems)
+	if len(problems) > 0 {
+		return &ValidationError{Problems: problems}
+	}
+	return nil
+}
+
+func validateComponents(doc *renderDocument, components []renderComponent, path string) []string {
+	var problems []string
+	for i, c := range components {
+		at := fmt.Sprintf("%s[%d]", path, i)
+		if len(c.Role) == 0 {
+			problems = append(problems, at+" has no role")
+		}
+		if name, ok := styleName(c.Layout); ok {
+			if _, defined := doc.ComponentLayouts[name]; !defined {
+				problems = append(problems, fmt.Sprintf("%s uses undefined layout %q", at, name))
+			}
+		}
+		if name, ok := styleName(c.Style); ok {
+			if _, defined := doc.ComponentStyles[name]; !defined {
+				problems = append(problems, fmt.Sprintf("%s uses undefined style %q", at, name))
+			}
+		}
+		if name, ok := styleName(c.TextStyle); ok {
+			if _, defined := doc.ComponentTextStyles[name]; !defined {
+				problems = append(problems, fmt.Sprintf("%s uses undefined text style %q", at, name))
+			}
+		}
+		problems = append(problems, validateComponents(doc, c.Components, at+".components")...)
+	}
+	return problems
+}
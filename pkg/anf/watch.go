@@ -0,0 +1,89 @@
+package anf
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/sdotz/apple-news-push-api/pkg/api"
+)
+
+//Watches the article.json of a bundle and the files it references. Changes are picked up by polling, and a burst of
+//changes, such as an editor saving several files, is reported once after the bundle has been quiet for Debounce
+type BundleWatcher struct {
+	Dir          string
+	Debounce     time.Duration
+	PollInterval time.Duration
+}
+
+func NewBundleWatcher(dir string, debounce time.Duration) *BundleWatcher {
+	return &BundleWatcher{
+		Dir:          dir,
+		Debounce:     debounce,
+		PollInterval: 200 * time.Millisecond,
+	}
+}
+
+//Calls onChange after every settled change until ctx is done
+func (w *BundleWatcher) Watch(ctx context.Context, onChange func()) error {
+	settled, err := w.fingerprint()
+	if err != nil {
+		return err
+	}
+	current := settled
+	var changedAt time.Time
+
+	ticker := time.NewTicker(w.PollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case now := <-ticker.C:
+			fingerprint, err := w.fingerprint()
+			if err != nil {
+				return err
+			}
+			if fingerprint != current {
+				current = fingerprint
+				changedAt = now
+			}
+			if current != settled && now.Sub(changedAt) >= w.Debounce {
+				settled = current
+				onChange()
+			}
+		}
+	}
+}
+
+//Only covers the files the bundle uses, so unrelated files such as editor backups don't trigger changes. A missing
+//file is part of the fingerprint too, so deleting and restoring one is noticed
+func (w *BundleWatcher) fingerprint() (string, error) {
+	h := sha256.New()
+	article := filepath.Join(w.Dir, "article.json")
+	b, err := ioutil.ReadFile(article)
+	if err != nil && !os.IsNotExist(err) {
+		return "", err
+	}
+	h.Write(b)
+
+	//An article.json that can't be scanned yet, say while it is being written, is fingerprinted by its bytes alone
+	references, _ := api.ScanBundleReferences(b)
+	for _, ref := range references {
+		info, err := os.Stat(filepath.Join(w.Dir, filepath.FromSlash(ref.Name)))
+		if os.IsNotExist(err) {
+			fmt.Fprintf(h, "%s\x00missing\x00", ref.Name)
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(h, "%s\x00%d\x00%d\x00", ref.Name, info.Size(), info.ModTime().UnixNano())
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
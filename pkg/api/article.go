@@ -2,6 +2,7 @@ package api
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -10,13 +11,12 @@ import (
 	"net/http"
 	"net/textproto"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
-	"os"
-	"path/filepath"
-	"regexp"
-
 	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type ContentType string
@@ -27,6 +27,9 @@ const (
 	ContentTypeJpeg        ContentType = "image/jpeg"
 	ContentTypePng         ContentType = "image/png"
 	ContentTypeGif         ContentType = "image/gif"
+	ContentTypeWebp        ContentType = "image/webp"
+	ContentTypeTtf         ContentType = "font/ttf"
+	ContentTypeOtf         ContentType = "font/otf"
 	ContentTypeOctetStream ContentType = "application/octet-stream"
 	ContentTypeJson        ContentType = "application/json"
 	ContentTypeHtml        ContentType = "text/html"
@@ -47,6 +50,38 @@ type Client struct {
 	APISecret string
 	BaseURL   string
 	ChannelID string
+
+	//When set, sent notifications are recorded here and duplicate sends within its dedupe window are refused
+	NotificationLog *NotificationLog
+	//Called when a sent notification can't be recorded in NotificationLog. The send still returns its response, so it
+	//isn't retried and pushed to readers twice. When nil the failure is written to stderr
+	NotificationLogFailed func(entry NotificationLogEntry, err error)
+	//When set, channel and section reads are served from it until they expire
+	MetadataCache *MetadataCache
+	//When set, bundle images are run through it before they are uploaded
+	ImageProcessor *ImageProcessor
+	//Every method call is traced as a span with child spans for its steps, through the global tracer provider unless
+	//this is set
+	TracerProvider trace.TracerProvider
+	//Signatures, and the times recorded or scheduled through the Client, go by this instead of time.Now when set
+	Clock func() time.Time
+	//When set, a 401 response whose Date header is more than a few seconds off our clock is taken as a sign of a skewed
+	//clock. The difference is added to the time of every later signature, and the refused request is sent once more
+	CorrectClockSkew bool
+	//When set, every call that changes the channel is recorded in it, along with the Operator who made it. Updates and
+	//deletes read the article first, so the entry can tell what it was before
+	Audit    AuditSink
+	Operator string
+	//Called when an entry can't be recorded in Audit. The call it was for still returns as it would have, so a change
+	//that was made isn't retried and made twice. When nil the failure is written to stderr
+	AuditFailed func(entry AuditEntry, err error)
+
+	ctx       context.Context
+	clockSkew atomic.Int64
+
+	sectionsMu sync.Mutex
+	sections   *ListSectionsResponse
+	middleware []Middleware
 }
 
 type MultipartUploadComponent struct {
@@ -125,19 +160,19 @@ type BundleComponent struct {
 }
 
 func (c *Client) ReadArticle(articleId string) (*ReadArticleResponse, error) {
-	url := fmt.Sprintf("%s/articles/%s", c.BaseURL, articleId)
-	req, err := http.NewRequest(http.MethodGet, url, nil)
-	if err != nil {
-		return nil, err
-	}
+	ctx, span := c.startSpan(c.context(), "ReadArticle", AttributeArticleID.String(articleId))
+	defer span.End()
+	return c.readArticle(ctx, articleId)
+}
 
-	auth, err := c.getAuthorization(http.MethodGet, url, "", ioutil.NopCloser(bytes.NewReader([]byte{})))
+func (c *Client) readArticle(ctx context.Context, articleId string) (*ReadArticleResponse, error) {
+	url := fmt.Sprintf("%s/articles/%s", c.BaseURL, articleId)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
 	if err != nil {
 		return nil, err
 	}
-	req.Header.Set("Authorization", auth)
 
-	resp, err := c.Client.Do(req)
+	resp, err := c.do(req)
 	if err != nil {
 		return nil, err
 	}
@@ -159,82 +194,19 @@ func (c *Client) ReadArticle(articleId string) (*ReadArticleResponse, error) {
 	return &readArticleResp, nil
 }
 
-func GetBundleComponents(articleJson io.Reader, bundleBasePath string) ([]MultipartUploadComponent, error) {
-	var matches [][]string
-	var bundleComponents []MultipartUploadComponent
-
-	re := regexp.MustCompile(`"bundle:\/\/(.*?)"`)
-
-	articleBytes, err := ioutil.ReadAll(articleJson)
-	if err != nil {
-		return nil, err
-	}
-
-	matches = re.FindAllStringSubmatch(string(articleBytes), -1)
-
-	if len(matches) > 0 {
-		for _, v := range matches {
-			bundleFile, err := os.Open(filepath.Join(bundleBasePath, v[1]))
-			if err != nil {
-				return nil, err
-			}
-
-			contentType, err := GetContentType(filepath.Ext(bundleFile.Name()))
-			if err != nil {
-				return bundleComponents, err
-			}
-
-			component := MultipartUploadComponent{
-				Data:        bundleFile,
-				Name:        strings.Split(filepath.Base(bundleFile.Name()), ".")[0],
-				FileName:    filepath.Base(bundleFile.Name()),
-				ContentType: contentType,
-			}
-			bundleComponents = append(bundleComponents, component)
-
-			if contentType == ContentTypeHtml {
-				additionalWebComponents, err := getAdditionalWebComponents(bundleBasePath)
-				if err != nil {
-					return nil, err
-				}
-				bundleComponents = append(bundleComponents, additionalWebComponents...)
-			}
-		}
-	}
-
-	return bundleComponents, nil
+func (c *Client) CreateArticle(article io.Reader, bundleComponents []MultipartUploadComponent, metadata *Metadata) (*ReadArticleResponse, error) {
+	return c.createArticle(c.context(), article, bundleComponents, metadata)
 }
 
-func getAdditionalWebComponents(bundleBasePath string) ([]MultipartUploadComponent, error) {
-	var components []MultipartUploadComponent
-	files, err := ioutil.ReadDir(bundleBasePath)
-
-	if err != nil {
-		return nil, err
-	}
-	for _, f := range files {
-		extension := strings.Split(f.Name(), ".")[1]
-		if extension == "css" || extension == "js" || extension == "manifest" {
-			contentType, err := GetContentType("." + extension)
-			if err != nil {
-				return nil, err
-			}
-			bundleFile, err := os.Open(filepath.Join(bundleBasePath, f.Name()))
-			if err != nil {
-				return nil, err
-			}
-			components = append(components, MultipartUploadComponent{
-				Data:        bundleFile,
-				Name:        strings.Split(filepath.Base(bundleFile.Name()), ".")[0],
-				FileName:    filepath.Base(bundleFile.Name()),
-				ContentType: contentType,
-			})
-		}
+func (c *Client) createArticle(ctx context.Context, article io.Reader, bundleComponents []MultipartUploadComponent, metadata *Metadata) (_ *ReadArticleResponse, err error) {
+	ctx, span := c.startSpan(ctx, "CreateArticle", AttributeChannelID.String(c.ChannelID))
+	defer span.End()
+	ctx, audit := c.startAudit(ctx, "CreateArticle")
+	defer c.finishAudit(audit, &err)
+	if metadata != nil {
+		audit.MetadataDiff = diffMetadata(nil, &metadata.Data)
 	}
-	return components, nil
-}
 
-func (c *Client) CreateArticle(article io.Reader, bundleComponents []MultipartUploadComponent, metadata *Metadata) (*ReadArticleResponse, error) {
 	url := fmt.Sprintf("%s/channels/%s/articles", c.BaseURL, c.ChannelID)
 
 	metadataBytes, err := json.Marshal(metadata)
@@ -261,9 +233,15 @@ func (c *Client) CreateArticle(article io.Reader, bundleComponents []MultipartUp
 		},
 	}
 
+	if c.ImageProcessor != nil {
+		if bundleComponents, err = c.ImageProcessor.Process(bundleComponents); err != nil {
+			return nil, err
+		}
+	}
 	multipartComponents = append(multipartComponents, bundleComponents...)
 
 	req, err := c.prepareMultipartRequest(
+		ctx,
 		multipartComponents,
 		url,
 	)
@@ -272,7 +250,7 @@ func (c *Client) CreateArticle(article io.Reader, bundleComponents []MultipartUp
 		return nil, err
 	}
 
-	resp, err := c.Client.Do(req)
+	resp, err := c.do(req)
 	if err != nil {
 		return nil, err
 	}
@@ -292,11 +270,25 @@ func (c *Client) CreateArticle(article io.Reader, bundleComponents []MultipartUp
 	if err != nil {
 		return nil, err
 	}
+	audit.ArticleID = readArticleResp.Data.ID
+	audit.RevisionAfter = readArticleResp.Data.Revision
 
 	return &readArticleResp, resp.Body.Close()
 }
 
 func (c *Client) UpdateArticle(articleId string, revision string, article io.Reader, bundleComponents []MultipartUploadComponent, metadata *Metadata) (*ReadArticleResponse, error) {
+	return c.updateArticle(c.context(), articleId, revision, article, bundleComponents, metadata)
+}
+
+func (c *Client) updateArticle(ctx context.Context, articleId string, revision string, article io.Reader, bundleComponents []MultipartUploadComponent, metadata *Metadata) (_ *ReadArticleResponse, err error) {
+	ctx, span := c.startSpan(ctx, "UpdateArticle", AttributeArticleID.String(articleId))
+	defer span.End()
+	ctx, audit := c.startAudit(ctx, "UpdateArticle")
+	defer c.finishAudit(audit, &err)
+	audit.ArticleID = articleId
+	audit.RevisionBefore = revision
+	before := c.auditArticleBefore(ctx, audit, articleId)
+
 	url := fmt.Sprintf("%s/articles/%s", c.BaseURL, articleId)
 
 	metadata.Data.Revision = revision
@@ -322,9 +314,15 @@ func (c *Client) UpdateArticle(articleId string, revision string, article io.Rea
 		},
 	}
 
+	if c.ImageProcessor != nil {
+		if bundleComponents, err = c.ImageProcessor.Process(bundleComponents); err != nil {
+			return nil, err
+		}
+	}
 	parts = append(parts, bundleComponents...)
 
 	req, err := c.prepareMultipartRequest(
+		ctx,
 		parts,
 		url,
 	)
@@ -333,7 +331,7 @@ func (c *Client) UpdateArticle(articleId string, revision string, article io.Rea
 		return nil, err
 	}
 
-	resp, err := c.Client.Do(req)
+	resp, err := c.do(req)
 	if err != nil {
 		return nil, err
 	}
@@ -354,10 +352,23 @@ func (c *Client) UpdateArticle(articleId string, revision string, article io.Rea
 		return nil, err
 	}
 
+	audit.RevisionAfter = readArticleResp.Data.Revision
+	if before != nil {
+		//Fields the request left out keep their values, so only what the article ended up with shows the change
+		audit.MetadataDiff = diffMetadata(before, articleMetadata(&readArticleResp))
+	}
 	return &readArticleResp, resp.Body.Close()
 }
 
-func (c *Client) UpdateArticleMetadata(articleId string, metadata *Metadata) (*ReadArticleResponse, error) {
+func (c *Client) UpdateArticleMetadata(articleId string, metadata *Metadata) (_ *ReadArticleResponse, err error) {
+	ctx, span := c.startSpan(c.context(), "UpdateArticleMetadata", AttributeArticleID.String(articleId))
+	defer span.End()
+	ctx, audit := c.startAudit(ctx, "UpdateArticleMetadata")
+	defer c.finishAudit(audit, &err)
+	audit.ArticleID = articleId
+	audit.RevisionBefore = metadata.Data.Revision
+	before := c.auditArticleBefore(ctx, audit, articleId)
+
 	url := fmt.Sprintf("%s/articles/%s", c.BaseURL, articleId)
 
 	metadataBytes, err := json.Marshal(metadata)
@@ -366,6 +377,7 @@ func (c *Client) UpdateArticleMetadata(articleId string, metadata *Metadata) (*R
 	}
 
 	req, err := c.prepareMultipartRequest(
+		ctx,
 		[]MultipartUploadComponent{
 			{
 				Data:        bytes.NewReader(metadataBytes),
@@ -380,7 +392,7 @@ func (c *Client) UpdateArticleMetadata(articleId string, metadata *Metadata) (*R
 		return nil, err
 	}
 
-	resp, err := c.Client.Do(req)
+	resp, err := c.do(req)
 	if err != nil {
 		return nil, err
 	}
@@ -400,10 +412,22 @@ func (c *Client) UpdateArticleMetadata(articleId string, metadata *Metadata) (*R
 		return nil, err
 	}
 
+	audit.RevisionAfter = readArticleResp.Data.Revision
+	if before != nil {
+		//Fields the request left out keep their values, so only what the article ended up with shows the change
+		audit.MetadataDiff = diffMetadata(before, articleMetadata(&readArticleResp))
+	}
 	return &readArticleResp, resp.Body.Close()
 }
 
-func (c *Client) PromoteArticles(sectionId string, articleIds []string) (*PromoteArticlesResponse, error) {
+func (c *Client) PromoteArticles(sectionId string, articleIds []string) (_ *PromoteArticlesResponse, err error) {
+	ctx, span := c.startSpan(c.context(), "PromoteArticles", AttributeSectionID.String(sectionId))
+	defer span.End()
+	ctx, audit := c.startAudit(ctx, "PromoteArticles")
+	defer c.finishAudit(audit, &err)
+	audit.SectionID = sectionId
+	audit.Details = map[string]interface{}{"promotedArticles": articleIds}
+
 	url := fmt.Sprintf("%s/sections/%s/promotedArticles", c.BaseURL, sectionId)
 
 	promotedArticles := PromoteArticlesRequest{}
@@ -417,15 +441,12 @@ func (c *Client) PromoteArticles(sectionId string, articleIds []string) (*Promot
 		return nil, err
 	}
 
-	req, _ := http.NewRequest(http.MethodPost, url, bytes.NewReader(bodyBytes))
+	req, _ := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(bodyBytes))
 
-	auth, err := c.getAuthorization(http.MethodPost, url, "", ioutil.NopCloser(bytes.NewReader(bodyBytes)))
-	if err != nil {
-		return nil, err
-	}
-	req.Header.Set("Authorization", auth)
+	//Declare and sign the body as JSON like SendNotification does, so clearing with an empty list is a well formed request
+	req.Header.Set("Content-Type", string(ContentTypeJson))
 
-	resp, err := c.Client.Do(req)
+	resp, err := c.do(req)
 	if err != nil {
 		return nil, err
 	}
@@ -445,20 +466,21 @@ func (c *Client) PromoteArticles(sectionId string, articleIds []string) (*Promot
 	return &promoteArticlesResponse, resp.Body.Close()
 }
 
-func (c *Client) DeleteArticle(articleId string) error {
-	url := fmt.Sprintf("%s/articles/%s", c.BaseURL, articleId)
-	req, err := http.NewRequest(http.MethodDelete, url, nil)
-	if err != nil {
-		return err
-	}
+func (c *Client) DeleteArticle(articleId string) (err error) {
+	ctx, span := c.startSpan(c.context(), "DeleteArticle", AttributeArticleID.String(articleId))
+	defer span.End()
+	ctx, audit := c.startAudit(ctx, "DeleteArticle")
+	defer c.finishAudit(audit, &err)
+	audit.ArticleID = articleId
+	c.auditArticleBefore(ctx, audit, articleId)
 
-	auth, err := c.getAuthorization(http.MethodDelete, url, "", ioutil.NopCloser(bytes.NewReader([]byte{})))
+	url := fmt.Sprintf("%s/articles/%s", c.BaseURL, articleId)
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, url, nil)
 	if err != nil {
 		return err
 	}
-	req.Header.Set("Authorization", auth)
 
-	resp, err := c.Client.Do(req)
+	resp, err := c.do(req)
 	if err != nil {
 		return err
 	}
@@ -470,7 +492,18 @@ func (c *Client) DeleteArticle(articleId string) error {
 	return nil
 }
 
-func (c *Client) prepareMultipartRequest(parts []MultipartUploadComponent, url string) (*http.Request, error) {
+func (c *Client) prepareMultipartRequest(ctx context.Context, parts []MultipartUploadComponent, url string) (*http.Request, error) {
+	_, span := c.startSpan(ctx, "build multipart body")
+	req, err := buildMultipartRequest(parts, url)
+	if err == nil {
+		req = req.WithContext(ctx)
+		span.SetAttributes(AttributeUploadBytes.Int64(req.ContentLength))
+	}
+	endSpan(span, err)
+	return req, err
+}
+
+func buildMultipartRequest(parts []MultipartUploadComponent, url string) (*http.Request, error) {
 	body := &bytes.Buffer{}
 	writer := multipart.NewWriter(body)
 
@@ -508,36 +541,9 @@ func (c *Client) prepareMultipartRequest(parts []MultipartUploadComponent, url s
 	}
 	req.Header.Set("Content-Type", writer.FormDataContentType())
 
-	auth, err := c.getAuthorization(http.MethodPost, url, writer.FormDataContentType(), ioutil.NopCloser(bytes.NewReader(body.Bytes())))
-	if err != nil {
-		return nil, err
-	}
-	req.Header.Set("Authorization", auth)
-
 	return req, err
 }
 
-func GetContentType(extension string) (ContentType, error) {
-	switch strings.ToLower(extension) {
-	case ".jpg", ".jpeg":
-		return ContentTypeJpeg, nil
-	case ".png":
-		return ContentTypePng, nil
-	case ".gif":
-		return ContentTypeGif, nil
-	case ".html":
-		return ContentTypeHtml, nil
-	case ".manifest":
-		return ContentTypeManifest, nil
-	case ".css":
-		return ContentTypeCss, nil
-	case ".js":
-		return ContentTypeJs, nil
-	default:
-		return "", errors.New(fmt.Sprintf("Could not match extension %s to a valid content type", extension))
-	}
-}
-
 var quoteEscaper = strings.NewReplacer("\\", "\\\\", `"`, "\\\"")
 
 func escapeQuotes(s string) string {
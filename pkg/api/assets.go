@@ -0,0 +1,290 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+//A file of the bundle that article.json references as bundle://Name
+type BundleReference struct {
+	//Slash separated path of the file relative to the bundle, e.g. images/header.jpg
+	Name string `json:"name"`
+	//Where the reference appears, e.g. components[2].URL. A file referenced several times is listed once with all of them
+	Fields []string `json:"fields"`
+}
+
+//What a bundle directory holds compared to what its article.json references
+type BundleScan struct {
+	References []BundleReference `json:"references"`
+	//Stylesheets, scripts and manifests uploaded along with referenced html files
+	WebAssets []string `json:"webAssets,omitempty"`
+	//Referenced files that don't exist in the bundle
+	Missing []string `json:"missing,omitempty"`
+	//Custom fonts text styles use, found in the bundle or the font directory
+	Fonts []BundleFont `json:"fonts,omitempty"`
+	//Fonts that couldn't be found and font files that aren't valid. These are warnings, as the API might still know
+	//the font
+	FontProblems []string `json:"fontProblems,omitempty"`
+	//Files in the bundle that nothing references and that won't be uploaded
+	Unused []string `json:"unused,omitempty"`
+}
+
+//Walks article.json and collects the bundle:// references of its URL properties, such as URL, fontURL and
+//thumbnailURL, once per file and in the order they first appear. Text that merely mentions bundle:// isn't a reference
+func ScanBundleReferences(articleJson []byte) ([]BundleReference, error) {
+	var doc interface{}
+	if err := json.Unmarshal(articleJson, &doc); err != nil {
+		return nil, errors.Wrap(err, "parsing article.json")
+	}
+
+	var references []BundleReference
+	index := make(map[string]int)
+	var walk func(v interface{}, field string, key string) error
+	walk = func(v interface{}, field string, key string) error {
+		switch v := v.(type) {
+		case string:
+			if !strings.HasSuffix(key, "URL") || !strings.HasPrefix(v, "bundle://") {
+				return nil
+			}
+			name, err := bundleFileName(strings.TrimPrefix(v, "bundle://"))
+			if err != nil {
+				return errors.Wrap(err, field)
+			}
+			if i, ok := index[name]; ok {
+				references[i].Fields = append(references[i].Fields, field)
+				return nil
+			}
+			index[name] = len(references)
+			references = append(references, BundleReference{Name: name, Fields: []string{field}})
+		case []interface{}:
+			for i, e := range v {
+				if err := walk(e, fmt.Sprintf("%s[%d]", field, i), key); err != nil {
+					return err
+				}
+			}
+		case map[string]interface{}:
+			//Sorted so references are reported in a stable order
+			keys := make([]string, 0, len(v))
+			for k := range v {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			for _, k := range keys {
+				f := k
+				if len(field) > 0 {
+					f = field + "." + k
+				}
+				if err := walk(v[k], f, k); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+	return references, walk(doc, "", "")
+}
+
+//Compares the references of article.json with the files in the bundle directory, including its subdirectories. Hidden
+//files such as .DS_Store are ignored
+func ScanBundle(articleJson []byte, bundleBasePath string) (*BundleScan, error) {
+	bundle, err := newAssetsBundle(bundleBasePath)
+	if err != nil {
+		return nil, err
+	}
+	return bundle.scan(articleJson)
+}
+
+//Returns the upload parts for the files article.json references. Fails when one is missing or has an unsupported
+//type, listing all of them, and files are only read to detect their type until their part is written
+func GetBundleComponents(articleJson io.Reader, bundleBasePath string) ([]MultipartUploadComponent, error) {
+	articleBytes, err := ioutil.ReadAll(articleJson)
+	if err != nil {
+		return nil, err
+	}
+	bundle, err := newAssetsBundle(bundleBasePath)
+	if err != nil {
+		return nil, err
+	}
+	return bundle.components(articleBytes)
+}
+
+//Compares the references of the bundle's article.json with the files in it
+func (b *Bundle) Scan() (*BundleScan, error) {
+	article, err := b.Article()
+	if err != nil {
+		return nil, err
+	}
+	return b.scan(article)
+}
+
+//Returns the upload parts for the files the bundle's article.json references, like GetBundleComponents
+func (b *Bundle) Components() ([]MultipartUploadComponent, error) {
+	article, err := b.Article()
+	if err != nil {
+		return nil, err
+	}
+	return b.components(article)
+}
+
+func (b *Bundle) scan(articleJson []byte) (*BundleScan, error) {
+	references, err := ScanBundleReferences(articleJson)
+	if err != nil {
+		return nil, err
+	}
+
+	scan := &BundleScan{References: references}
+	used := map[string]bool{"article.json": true}
+	hasHtml := false
+	for _, r := range references {
+		used[r.Name] = true
+		if !b.Has(r.Name) {
+			scan.Missing = append(scan.Missing, r.Name)
+		}
+		hasHtml = hasHtml || strings.ToLower(path.Ext(r.Name)) == ".html"
+	}
+
+	if err := b.scanFonts(articleJson, scan); err != nil {
+		return nil, err
+	}
+	for _, font := range scan.Fonts {
+		if !font.FromFontDir {
+			used[font.Path] = true
+		}
+	}
+
+	for _, name := range b.Files() {
+		if used[name] {
+			continue
+		}
+		switch strings.ToLower(path.Ext(name)) {
+		case ".css", ".js", ".manifest":
+			if hasHtml {
+				scan.WebAssets = append(scan.WebAssets, name)
+				continue
+			}
+		}
+		scan.Unused = append(scan.Unused, name)
+	}
+	return scan, nil
+}
+
+func (b *Bundle) components(articleJson []byte) ([]MultipartUploadComponent, error) {
+	scan, err := b.scan(articleJson)
+	if err != nil {
+		return nil, err
+	}
+	if len(scan.Missing) > 0 {
+		return nil, errors.Errorf("article.json references files missing from the bundle: %s", strings.Join(scan.Missing, ", "))
+	}
+
+	var names []string
+	for _, r := range scan.References {
+		names = append(names, r.Name)
+	}
+	names = append(names, scan.WebAssets...)
+
+	var bundleComponents []MultipartUploadComponent
+	var unsupported []string
+	for _, name := range names {
+		contentType, err := b.contentType(name)
+		if err != nil {
+			return nil, err
+		}
+		if len(contentType) == 0 {
+			unsupported = append(unsupported, name)
+			continue
+		}
+		bundleComponents = append(bundleComponents, MultipartUploadComponent{
+			Data:        &bundleFile{open: b.files[name]},
+			Name:        strings.TrimSuffix(name, path.Ext(name)),
+			FileName:    name,
+			ContentType: contentType,
+		})
+	}
+	uploaded := make(map[string]bool, len(names))
+	for _, name := range names {
+		uploaded[name] = true
+	}
+	for _, font := range scan.Fonts {
+		//Already uploaded when article.json also references it with a bundle:// URL
+		if uploaded[font.Path] {
+			continue
+		}
+		contentType, err := DetectContentType(font.Path, font.data, b.ContentTypes)
+		if err != nil {
+			unsupported = append(unsupported, font.Path)
+			continue
+		}
+		bundleComponents = append(bundleComponents, MultipartUploadComponent{
+			Data:        bytes.NewReader(font.data),
+			Name:        strings.TrimSuffix(font.Path, path.Ext(font.Path)),
+			FileName:    font.Path,
+			ContentType: contentType,
+		})
+	}
+	if len(unsupported) > 0 {
+		return nil, &UnsupportedContentError{Files: unsupported}
+	}
+	return bundleComponents, nil
+}
+
+//Returns an empty content type for files that aren't supported
+func (b *Bundle) contentType(name string) (ContentType, error) {
+	f, err := b.Open(name)
+	if err != nil {
+		return "", err
+	}
+	header, err := readContentHeader(f)
+	f.Close()
+	if err != nil {
+		return "", errors.Wrap(err, name)
+	}
+	contentType, err := DetectContentType(name, header, b.ContentTypes)
+	if err != nil {
+		return "", nil
+	}
+	return contentType, nil
+}
+
+//Cleans a referenced name, refusing ones that point outside the bundle
+func bundleFileName(name string) (string, error) {
+	cleaned := path.Clean(name)
+	if len(name) == 0 || path.IsAbs(cleaned) || cleaned == ".." || strings.HasPrefix(cleaned, "../") {
+		return "", errors.Errorf("bundle://%s isn't a file in the bundle", name)
+	}
+	return cleaned, nil
+}
+
+//Opens the file on its first read and closes it at the end, so nothing is left open when a request isn't sent
+type bundleFile struct {
+	open func() (io.ReadCloser, error)
+	f    io.ReadCloser
+	done bool
+}
+
+func (b *bundleFile) Read(p []byte) (int, error) {
+	if b.done {
+		return 0, io.EOF
+	}
+	if b.f == nil {
+		f, err := b.open()
+		if err != nil {
+			return 0, err
+		}
+		b.f = f
+	}
+	n, err := b.f.Read(p)
+	if err != nil {
+		b.f.Close()
+		b.done = true
+	}
+	return n, err
+}
@@ -0,0 +1,291 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	AuditResultOK     = "ok"
+	AuditResultFailed = "failed"
+)
+
+//A call that changed something in the channel, or tried to
+type AuditEntry struct {
+	Time      time.Time `json:"time"`
+	Operator  string    `json:"operator,omitempty"`
+	Host      string    `json:"host,omitempty"`
+	Channel   string    `json:"channel,omitempty"`
+	Operation string    `json:"operation"`
+	ArticleID string    `json:"articleId,omitempty"`
+	SectionID string    `json:"sectionId,omitempty"`
+	//The article's revision before the call, for updates and deletes, and after it, for creates and updates
+	RevisionBefore string `json:"revisionBefore,omitempty"`
+	RevisionAfter  string `json:"revisionAfter,omitempty"`
+	//The metadata fields the call changed, such as isHidden or links.sections
+	MetadataDiff map[string]AuditChange `json:"metadataDiff,omitempty"`
+	//SHA-256 of the request body sent, so an upload can be matched to the bundle it came from
+	PayloadSha256 string                 `json:"payloadSha256,omitempty"`
+	Details       map[string]interface{} `json:"details,omitempty"`
+	Status        int                    `json:"status,omitempty"`
+	Result        string                 `json:"result"`
+	Error         string                 `json:"error,omitempty"`
+}
+
+type AuditChange struct {
+	Before interface{} `json:"before"`
+	After  interface{} `json:"after"`
+}
+
+//Where audit entries are recorded, such as an AuditLog, a SyslogAuditSink or a WebhookAuditSink
+type AuditSink interface {
+	Record(entry AuditEntry) error
+}
+
+//Records every entry in each of the sinks, returning the first error after trying all of them
+type AuditSinks []AuditSink
+
+func (s AuditSinks) Record(entry AuditEntry) error {
+	var first error
+	for _, sink := range s {
+		if err := sink.Record(entry); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+//An append-only JSON lines file of audit entries
+type AuditLog struct {
+	Path string
+
+	mu sync.Mutex
+}
+
+func NewAuditLog(path string) *AuditLog {
+	return &AuditLog{Path: path}
+}
+
+func (l *AuditLog) Record(entry AuditEntry) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return appendJSONLine(l.Path, entry)
+}
+
+//Returns every entry in the log, oldest first. A missing log file is treated as empty
+func (l *AuditLog) Entries() ([]AuditEntry, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return readJSONLines[AuditEntry](l.Path)
+}
+
+//Posts every entry as JSON to a URL, such as a chat or SIEM webhook
+type WebhookAuditSink struct {
+	URL string
+	//Added to every request, e.g. for an API token
+	Headers map[string]string
+	Client  *http.Client
+}
+
+func NewWebhookAuditSink(url string) *WebhookAuditSink {
+	return &WebhookAuditSink{URL: url, Client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+func (s *WebhookAuditSink) Record(entry AuditEntry) error {
+	b, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, s.URL, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", string(ContentTypeJson))
+	for name, value := range s.Headers {
+		req.Header.Set(name, value)
+	}
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return errors.Errorf("audit webhook %s returned a %d", s.URL, resp.StatusCode)
+	}
+	return nil
+}
+
+var (
+	auditHostOnce sync.Once
+	auditHost     string
+)
+
+func hostname() string {
+	auditHostOnce.Do(func() {
+		auditHost, _ = os.Hostname()
+	})
+	return auditHost
+}
+
+type auditContextKey struct{}
+
+//Starts the audit entry of a mutating call. It is carried in the returned context, so the request sent for the call
+//can add its payload hash and status. Without an Audit sink it is never recorded
+func (c *Client) startAudit(ctx context.Context, operation string) (context.Context, *AuditEntry) {
+	entry := &AuditEntry{
+		Time:      c.Now().UTC(),
+		Operator:  c.Operator,
+		Host:      hostname(),
+		Channel:   c.ChannelID,
+		Operation: operation,
+	}
+	if c.Audit == nil {
+		return ctx, entry
+	}
+	return context.WithValue(ctx, auditContextKey{}, entry), entry
+}
+
+//Records the entry of a call that returned err. Failing to is reported to AuditFailed rather than returned, as the call
+//has been made either way and callers that retry on errors would make the change twice
+func (c *Client) finishAudit(entry *AuditEntry, err *error) {
+	if c.Audit == nil {
+		return
+	}
+	entry.Result = AuditResultOK
+	if *err != nil {
+		entry.Result = AuditResultFailed
+		entry.Error = (*err).Error()
+	}
+	auditErr := c.Audit.Record(*entry)
+	switch {
+	case auditErr == nil:
+	case c.AuditFailed != nil:
+		c.AuditFailed(*entry, auditErr)
+	default:
+		fmt.Fprintf(os.Stderr, "%s of %s could not be recorded in the audit log: %s\n", entry.Operation, auditSubject(entry), auditErr)
+	}
+}
+
+func auditSubject(entry *AuditEntry) string {
+	switch {
+	case len(entry.ArticleID) > 0:
+		return "article " + entry.ArticleID
+	case len(entry.SectionID) > 0:
+		return "section " + entry.SectionID
+	default:
+		return "channel " + entry.Channel
+	}
+}
+
+//Adds what was sent and what came back to the audit entry of the call that sent the request, if it has one
+func recordAudit(req *http.Request, resp *http.Response) {
+	entry, ok := req.Context().Value(auditContextKey{}).(*AuditEntry)
+	if !ok {
+		return
+	}
+	if resp != nil {
+		entry.Status = resp.StatusCode
+	}
+	if req.GetBody == nil {
+		return
+	}
+	body, err := req.GetBody()
+	if err != nil {
+		return
+	}
+	defer body.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, body); err == nil {
+		entry.PayloadSha256 = hex.EncodeToString(h.Sum(nil))
+	}
+}
+
+//Reads the article as it was before a call changes it, for the audit entry. Failing to read it doesn't stop the call
+func (c *Client) auditArticleBefore(ctx context.Context, entry *AuditEntry, articleId string) *Data {
+	if c.Audit == nil {
+		return nil
+	}
+	//The read isn't part of the audited call, so it mustn't fill in the entry
+	article, err := c.readArticle(context.WithValue(ctx, auditContextKey{}, nil), articleId)
+	if err != nil {
+		return nil
+	}
+	entry.RevisionBefore = article.Data.Revision
+	if len(article.Data.Title) > 0 {
+		if entry.Details == nil {
+			entry.Details = make(map[string]interface{})
+		}
+		entry.Details["title"] = article.Data.Title
+	}
+	return articleMetadata(article)
+}
+
+//Lists the metadata fields that differ between before and after, with nested fields such as links.sections named by
+//their path. A nil before is an article that didn't exist, so every field after sets is a change
+func diffMetadata(before *Data, after *Data) map[string]AuditChange {
+	if after == nil {
+		return nil
+	}
+	afterFields := flattenMetadata(after)
+	beforeFields := map[string]interface{}{}
+	if before != nil {
+		beforeFields = flattenMetadata(before)
+	}
+
+	keys := make([]string, 0, len(afterFields)+len(beforeFields))
+	for k := range afterFields {
+		keys = append(keys, k)
+	}
+	for k := range beforeFields {
+		if _, ok := afterFields[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	diff := make(map[string]AuditChange)
+	for _, k := range keys {
+		if k == "revision" || reflect.DeepEqual(beforeFields[k], afterFields[k]) {
+			continue
+		}
+		diff[k] = AuditChange{Before: beforeFields[k], After: afterFields[k]}
+	}
+	if len(diff) == 0 {
+		return nil
+	}
+	return diff
+}
+
+//Turns metadata into its JSON fields, leaving out the ones at their zero value as the API does
+func flattenMetadata(d *Data) map[string]interface{} {
+	b, _ := json.Marshal(d)
+	var fields map[string]interface{}
+	json.Unmarshal(b, &fields)
+
+	flat := make(map[string]interface{})
+	var walk func(prefix string, m map[string]interface{})
+	walk = func(prefix string, m map[string]interface{}) {
+		for k, v := range m {
+			if nested, ok := v.(map[string]interface{}); ok {
+				walk(prefix+k+".", nested)
+				continue
+			}
+			flat[prefix+k] = v
+		}
+	}
+	walk("", fields)
+	return flat
+}
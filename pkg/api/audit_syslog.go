@@ -0,0 +1,37 @@
+//go:build !windows && !plan9
+
+package api
+
+import (
+	"encoding/json"
+	"log/syslog"
+)
+
+//Sends every entry as JSON to the local syslog daemon, failed calls at warning level and the rest at notice
+type SyslogAuditSink struct {
+	writer *syslog.Writer
+}
+
+//Connects to the local syslog daemon, logging as the auth facility with tag
+func NewSyslogAuditSink(tag string) (*SyslogAuditSink, error) {
+	w, err := syslog.New(syslog.LOG_NOTICE|syslog.LOG_AUTH, tag)
+	if err != nil {
+		return nil, err
+	}
+	return &SyslogAuditSink{writer: w}, nil
+}
+
+func (s *SyslogAuditSink) Record(entry AuditEntry) error {
+	b, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	if entry.Result == AuditResultFailed {
+		return s.writer.Warning(string(b))
+	}
+	return s.writer.Notice(string(b))
+}
+
+func (s *SyslogAuditSink) Close() error {
+	return s.writer.Close()
+}
@@ -0,0 +1,21 @@
+//go:build windows || plan9
+
+package api
+
+import (
+	"github.com/pkg/errors"
+)
+
+type SyslogAuditSink struct{}
+
+func NewSyslogAuditSink(tag string) (*SyslogAuditSink, error) {
+	return nil, errors.New("syslog isn't available on this platform")
+}
+
+func (s *SyslogAuditSink) Record(entry AuditEntry) error {
+	return errors.New("syslog isn't available on this platform")
+}
+
+func (s *SyslogAuditSink) Close() error {
+	return nil
+}
@@ -1,18 +1,70 @@
 package api
 
 import (
+	"bytes"
 	"crypto/hmac"
 	"crypto/sha256"
 	"encoding/base64"
 	"fmt"
 	"io"
+	"io/ioutil"
+	"net/http"
 	"time"
 )
 
-//Builds the Authorization header according to the spec defined here: https://developer.apple.com/library/content/documentation/General/Conceptual/News_API_Ref/Security.html#//apple_ref/doc/uid/TP40015409-CH5-SW1
-func (c *Client) getAuthorization(httpMethod string, url string, contentType string, body io.ReadCloser) (string, error) {
-	defer body.Close()
-	timeNow := time.Now().UTC().Format(time.RFC3339)
+//Sets the Authorization header of a request, signing its method, URL, content type and body
+func (c *Client) sign(req *http.Request) error {
+	//Middleware may have replaced the body with one that can only be read once
+	if err := bufferBody(req); err != nil {
+		return err
+	}
+	body := []byte{}
+	if req.Body != nil && req.Body != http.NoBody {
+		rc, err := req.GetBody()
+		if err != nil {
+			return err
+		}
+		body, err = ioutil.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	auth, err := c.Sign(req.Method, req.URL.String(), req.Header.Get("Content-Type"), body, c.signingTime())
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", auth)
+	return nil
+}
+
+//Reads a body that can only be read once into memory and sets GetBody, so the request can be signed and sent again
+func bufferBody(req *http.Request) error {
+	if req.Body == nil || req.Body == http.NoBody || req.GetBody != nil {
+		return nil
+	}
+	body, err := ioutil.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return err
+	}
+	req.GetBody = func() (io.ReadCloser, error) {
+		return ioutil.NopCloser(bytes.NewReader(body)), nil
+	}
+	req.Body, _ = req.GetBody()
+	return nil
+}
+
+//Builds the Authorization header of a request dated at, according to the spec defined here: https://developer.apple.com/library/content/documentation/General/Conceptual/News_API_Ref/Security.html#//apple_ref/doc/uid/TP40015409-CH5-SW1
+//The same arguments always give the same header, so it can be used to check signatures too
+func (c *Client) Sign(httpMethod string, url string, contentType string, body []byte, at time.Time) (string, error) {
+	return c.signWithDate(httpMethod, url, contentType, body, at.UTC().Format(time.RFC3339))
+}
+
+//Signs with the date exactly as written, which is what the signature covers, so one dated with an offset or fractional
+//seconds can be verified too
+func (c *Client) signWithDate(httpMethod string, url string, contentType string, body []byte, date string) (string, error) {
 	apiSecretDecoded, err := base64.StdEncoding.DecodeString(c.APISecret)
 	if err != nil {
 		return "", err
@@ -20,16 +72,46 @@ func (c *Client) getAuthorization(httpMethod string, url string, contentType str
 	mac := hmac.New(sha256.New, apiSecretDecoded)
 
 	//The beginning of the "canonical request".The body will then be appended onto it.
-	_, err = mac.Write([]byte(fmt.Sprintf("%s%s%s%s", httpMethod, url, timeNow, contentType)))
+	_, err = mac.Write([]byte(fmt.Sprintf("%s%s%s%s", httpMethod, url, date, contentType)))
 	if err != nil {
 		return "", err
 	}
+	mac.Write(body)
 
-	if _, err := io.Copy(mac, body); err != nil {
-		return "", err
+	signature := base64.StdEncoding.EncodeToString(mac.Sum(nil))
+
+	return fmt.Sprintf("HHMAC; key=%s; signature=%s; date=%s", c.APIKey, signature, date), nil
+}
+
+//Differences between the server's clock and ours smaller than this aren't corrected, as the Date header only has
+//whole seconds and arrives some time after the server set it
+const clockSkewTolerance = 5 * time.Second
+
+//The current time by Clock, which is what everything the Client and the types built on it record or schedule goes by
+func (c *Client) Now() time.Time {
+	if c.Clock != nil {
+		return c.Clock()
 	}
+	return time.Now()
+}
 
-	signature := base64.StdEncoding.EncodeToString(mac.Sum(nil))
+//The time signatures are dated with: the clock corrected by the skew learned from the server
+func (c *Client) signingTime() time.Time {
+	return c.Now().Add(time.Duration(c.clockSkew.Load()))
+}
 
-	return fmt.Sprintf("HHMAC; key=%s; signature=%s; date=%s", c.APIKey, signature, timeNow), nil
+//Learns how far our clock is off from the Date header of a response, reporting whether the correction changed enough
+//that a refused signature is worth trying again
+func (c *Client) learnClockSkew(resp *http.Response) bool {
+	serverTime, err := http.ParseTime(resp.Header.Get("Date"))
+	if err != nil {
+		return false
+	}
+	skew := serverTime.Sub(c.Now())
+	previous := time.Duration(c.clockSkew.Load())
+	if diff := skew - previous; diff < clockSkewTolerance && diff > -clockSkewTolerance {
+		return false
+	}
+	c.clockSkew.Store(int64(skew))
+	return true
 }
@@ -0,0 +1,212 @@
+package api
+
+import (
+	"path"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+//The most articles the API returns in one page of search results
+const maxSearchPageSize = 100
+
+//Pages through every article a search finds, e.g.
+//
+//	it := client.IterateArticles(options)
+//	for it.Next() {
+//		fmt.Println(it.Article().Title)
+//	}
+//	if err := it.Err(); err != nil {
+type SearchIterator struct {
+	client  *Client
+	options SearchArticlesOptions
+	page    []SearchArticle
+	i       int
+	last    bool
+	err     error
+}
+
+//Starts iterating over the articles the options search for, from the page they point at
+func (c *Client) IterateArticles(options *SearchArticlesOptions) *SearchIterator {
+	return &SearchIterator{client: c, options: *options, i: -1}
+}
+
+//Moves to the next article, fetching the next page when needed. Returns false when there are no more or a page
+//couldn't be fetched, see Err
+func (it *SearchIterator) Next() bool {
+	it.i++
+	for it.i >= len(it.page) {
+		if it.last || it.err != nil {
+			return false
+		}
+		resp, err := it.client.SearchArticles(&it.options)
+		if err != nil {
+			it.err = err
+			return false
+		}
+		it.page, it.i = resp.Data, 0
+		it.options.PageToken = resp.Meta.NextPageToken
+		it.last = len(it.options.PageToken) == 0
+	}
+	return true
+}
+
+func (it *SearchIterator) Article() SearchArticle {
+	return it.page[it.i]
+}
+
+func (it *SearchIterator) Err() error {
+	return it.err
+}
+
+//Which articles of the channel a bulk operation applies to. Empty fields match every article
+type ArticleFilter struct {
+	//Only articles created in this range, which the search itself is limited to
+	FromDate *time.Time
+	ToDate   *time.Time
+	States   []string
+	Title    *regexp.Regexp
+	//Section links, IDs or names. Articles in any of them match
+	Sections []string
+}
+
+//Parses conditions such as "from=2024-01-01", "to=2024-02-01", "state=LIVE,PROCESSING", "title~^TEST" or
+//"section=Sports,Tech". Dates are days or RFC 3339 times, and title takes a regular expression
+func ParseArticleFilter(conditions []string) (*ArticleFilter, error) {
+	filter := &ArticleFilter{}
+	for _, condition := range conditions {
+		i := strings.IndexAny(condition, "=~")
+		if i <= 0 {
+			return nil, errors.Errorf("%q isn't a condition like state=LIVE or title~regexp", condition)
+		}
+		key, op, value := strings.TrimSpace(condition[:i]), condition[i], strings.TrimSpace(condition[i+1:])
+		if (key == "title") != (op == '~') {
+			return nil, errors.Errorf("%q: use title~regexp to match titles and key=value for the rest", condition)
+		}
+
+		switch key {
+		case "from", "to":
+			t, err := parseFilterTime(value)
+			if err != nil {
+				return nil, errors.Wrap(err, condition)
+			}
+			if key == "from" {
+				filter.FromDate = &t
+			} else {
+				filter.ToDate = &t
+			}
+		case "state":
+			for _, state := range strings.Split(value, ",") {
+				filter.States = append(filter.States, strings.ToUpper(strings.TrimSpace(state)))
+			}
+		case "title":
+			re, err := regexp.Compile(value)
+			if err != nil {
+				return nil, errors.Wrap(err, condition)
+			}
+			filter.Title = re
+		case "section":
+			filter.Sections = append(filter.Sections, value)
+		default:
+			return nil, errors.Errorf("%q: unknown field %s, use from, to, state, title or section", condition, key)
+		}
+	}
+	return filter, nil
+}
+
+func parseFilterTime(value string) (time.Time, error) {
+	if t, err := time.Parse("2006-01-02", value); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+//Searches the channel for every article the filter matches, newest first
+func (c *Client) FindArticles(filter *ArticleFilter) ([]SearchArticle, error) {
+	sectionIds := make(map[string]bool)
+	if len(filter.Sections) > 0 {
+		links, err := c.ResolveSections(filter.Sections)
+		if err != nil {
+			return nil, err
+		}
+		for _, link := range links {
+			sectionIds[path.Base(link)] = true
+		}
+	}
+
+	options := DefaultSearchArticlesOptions()
+	options.PageSize = maxSearchPageSize
+	options.FromDate = filter.FromDate
+	options.ToDate = filter.ToDate
+
+	var matched []SearchArticle
+	it := c.IterateArticles(options)
+	for it.Next() {
+		if article := it.Article(); filter.matches(&article, sectionIds) {
+			matched = append(matched, article)
+		}
+	}
+	return matched, it.Err()
+}
+
+func (f *ArticleFilter) matches(a *SearchArticle, sectionIds map[string]bool) bool {
+	if f.FromDate != nil && a.CreatedAt.Before(*f.FromDate) || f.ToDate != nil && !a.CreatedAt.Before(*f.ToDate) {
+		return false
+	}
+	if len(f.States) > 0 {
+		found := false
+		for _, state := range f.States {
+			found = found || strings.EqualFold(state, a.State)
+		}
+		if !found {
+			return false
+		}
+	}
+	if f.Title != nil && !f.Title.MatchString(a.Title) {
+		return false
+	}
+	if len(sectionIds) > 0 {
+		for _, link := range a.Links.Sections {
+			if sectionIds[path.Base(link)] {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+//The outcome of a bulk operation on one article
+type BulkResult struct {
+	ArticleID string `json:"articleId"`
+	Title     string `json:"title"`
+	Error     string `json:"error,omitempty"`
+}
+
+//Calls apply for every article, running at most concurrency at a time, and returns the results in the order of the
+//articles. A failure doesn't stop the others
+func BulkApply(articles []SearchArticle, concurrency int, apply func(SearchArticle) error) []BulkResult {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	results := make([]BulkResult, len(articles))
+	slots := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i, article := range articles {
+		results[i] = BulkResult{ArticleID: article.ID, Title: article.Title}
+		wg.Add(1)
+		slots <- struct{}{}
+		go func(i int, article SearchArticle) {
+			defer wg.Done()
+			defer func() { <-slots }()
+			if err := apply(article); err != nil {
+				results[i].Error = err.Error()
+			}
+		}(i, article)
+	}
+	wg.Wait()
+	return results
+}
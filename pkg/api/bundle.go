@@ -0,0 +1,289 @@
+package api
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+//An article.json together with the files it references, wherever they are kept. Paths are slash separated and relative
+//to the bundle. Bundles opened from archives hold them open until Close
+type Bundle struct {
+	//Content types to upload files as, keyed by their path in the bundle or by extension, e.g. ".woff". They win over
+	//what DetectContentType would pick
+	ContentTypes map[string]ContentType
+	//Where custom fonts text styles use are looked for when the bundle doesn't include them
+	FontDir string
+
+	files  map[string]func() (io.ReadCloser, error)
+	closer io.Closer
+}
+
+//Opens a bundle directory, or a .zip, .tar.gz or .tgz archive of one, depending on what path is
+func OpenBundle(p string) (*Bundle, error) {
+	info, err := os.Stat(p)
+	if err != nil {
+		return nil, err
+	}
+	lower := strings.ToLower(p)
+	switch {
+	case info.IsDir():
+		return NewDirBundle(p)
+	case strings.HasSuffix(lower, ".zip"):
+		return OpenZipBundle(p)
+	case strings.HasSuffix(lower, ".tar.gz"), strings.HasSuffix(lower, ".tgz"):
+		return OpenTarGzBundle(p)
+	default:
+		return nil, errors.Errorf("%s is neither a bundle directory nor a .zip, .tar.gz or .tgz archive", p)
+	}
+}
+
+func NewDirBundle(dir string) (*Bundle, error) {
+	return NewFSBundle(os.DirFS(dir))
+}
+
+//Reads the bundle from the root of fsys
+func NewFSBundle(fsys fs.FS) (*Bundle, error) {
+	files, err := fsFiles(fsys)
+	if err != nil {
+		return nil, err
+	}
+	return newBundle(files)
+}
+
+//Opens the files of a directory of assets whose article.json is kept elsewhere, as ScanBundle and
+//GetBundleComponents take it separately
+func newAssetsBundle(dir string) (*Bundle, error) {
+	files, err := fsFiles(os.DirFS(dir))
+	if err != nil {
+		return nil, err
+	}
+	return &Bundle{files: visibleBundleFiles(files)}, nil
+}
+
+func fsFiles(fsys fs.FS) (map[string]func() (io.ReadCloser, error), error) {
+	files := make(map[string]func() (io.ReadCloser, error))
+	err := fs.WalkDir(fsys, ".", func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		name := p
+		files[name] = func() (io.ReadCloser, error) {
+			return fsys.Open(name)
+		}
+		return nil
+	})
+	return files, err
+}
+
+//Builds a bundle from file contents keyed by their path in the bundle
+func NewMemoryBundle(contents map[string][]byte) (*Bundle, error) {
+	files := make(map[string]func() (io.ReadCloser, error))
+	for name, b := range contents {
+		b := b
+		files[path.Clean(name)] = func() (io.ReadCloser, error) {
+			return ioutil.NopCloser(bytes.NewReader(b)), nil
+		}
+	}
+	return newBundle(files)
+}
+
+//Opens a zip archive of a bundle. The archive stays open until Close
+func OpenZipBundle(p string) (*Bundle, error) {
+	r, err := zip.OpenReader(p)
+	if err != nil {
+		return nil, err
+	}
+	b, err := NewFSBundle(&r.Reader)
+	if err != nil {
+		r.Close()
+		return nil, err
+	}
+	b.closer = r
+	return b, nil
+}
+
+func OpenTarGzBundle(p string) (*Bundle, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ReadTarGzBundle(f)
+}
+
+//Reads a gzipped tar archive of a bundle into memory, so it can come straight from a download or another process
+func ReadTarGzBundle(r io.Reader) (*Bundle, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	defer gz.Close()
+
+	contents := make(map[string][]byte)
+	t := tar.NewReader(gz)
+	for {
+		h, err := t.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if h.Typeflag != tar.TypeReg {
+			continue
+		}
+		b, err := ioutil.ReadAll(t)
+		if err != nil {
+			return nil, err
+		}
+		contents[h.Name] = b
+	}
+	return NewMemoryBundle(contents)
+}
+
+//Drops hidden files and archive metadata, and looks inside a single top level directory when article.json isn't at the
+//root, as archives of a directory usually have one
+func newBundle(files map[string]func() (io.ReadCloser, error)) (*Bundle, error) {
+	cleaned := visibleBundleFiles(files)
+	if _, ok := cleaned["article.json"]; !ok {
+		var roots []string
+		for name := range cleaned {
+			if strings.HasSuffix(name, "/article.json") && strings.Count(name, "/") == 1 {
+				roots = append(roots, strings.TrimSuffix(name, "article.json"))
+			}
+		}
+		sort.Strings(roots)
+		switch {
+		case len(roots) == 0:
+			return nil, errors.New("the bundle has no article.json")
+		case len(roots) > 1:
+			return nil, errors.Errorf("the bundle has no article.json at its root but one in each of %s, so which to use is ambiguous", strings.Join(roots, ", "))
+		}
+		rooted := make(map[string]func() (io.ReadCloser, error))
+		for name, open := range cleaned {
+			if strings.HasPrefix(name, roots[0]) {
+				rooted[strings.TrimPrefix(name, roots[0])] = open
+			}
+		}
+		cleaned = rooted
+	}
+	return &Bundle{files: cleaned}, nil
+}
+
+//Cleans the paths of the files and drops the hidden ones
+func visibleBundleFiles(files map[string]func() (io.ReadCloser, error)) map[string]func() (io.ReadCloser, error) {
+	cleaned := make(map[string]func() (io.ReadCloser, error))
+	for name, open := range files {
+		name = strings.TrimPrefix(path.Clean("/"+name), "/")
+		if isHiddenBundlePath(name) {
+			continue
+		}
+		cleaned[name] = open
+	}
+	return cleaned
+}
+
+func isHiddenBundlePath(name string) bool {
+	for _, part := range strings.Split(name, "/") {
+		if strings.HasPrefix(part, ".") || part == "__MACOSX" {
+			return true
+		}
+	}
+	return false
+}
+
+//Lists the paths of the files in the bundle, sorted
+func (b *Bundle) Files() []string {
+	names := make([]string, 0, len(b.files))
+	for name := range b.files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (b *Bundle) Has(name string) bool {
+	_, ok := b.files[name]
+	return ok
+}
+
+func (b *Bundle) Open(name string) (io.ReadCloser, error) {
+	open, ok := b.files[name]
+	if !ok {
+		return nil, errors.Errorf("%s isn't in the bundle", name)
+	}
+	return open()
+}
+
+func (b *Bundle) ReadFile(name string) ([]byte, error) {
+	f, err := b.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ioutil.ReadAll(f)
+}
+
+func (b *Bundle) Article() ([]byte, error) {
+	return b.ReadFile("article.json")
+}
+
+func (b *Bundle) Close() error {
+	if b.closer == nil {
+		return nil
+	}
+	return b.closer.Close()
+}
+
+//Creates an article from the bundle's article.json and the files it references
+func (c *Client) CreateArticleBundle(bundle *Bundle, metadata *Metadata) (*ReadArticleResponse, error) {
+	ctx, span := c.startSpan(c.context(), "CreateArticleBundle", AttributeChannelID.String(c.ChannelID))
+	defer span.End()
+
+	article, components, err := c.scanBundle(ctx, bundle)
+	if err != nil {
+		return nil, err
+	}
+	return c.createArticle(ctx, bytes.NewReader(article), components, metadata)
+}
+
+//Updates an article with the bundle's article.json and the files it references
+func (c *Client) UpdateArticleBundle(articleId string, revision string, bundle *Bundle, metadata *Metadata) (*ReadArticleResponse, error) {
+	ctx, span := c.startSpan(c.context(), "UpdateArticleBundle", AttributeArticleID.String(articleId))
+	defer span.End()
+
+	article, components, err := c.scanBundle(ctx, bundle)
+	if err != nil {
+		return nil, err
+	}
+	return c.updateArticle(ctx, articleId, revision, bytes.NewReader(article), components, metadata)
+}
+
+//Reads the bundle's article.json and the files it references to upload
+func (c *Client) scanBundle(ctx context.Context, bundle *Bundle) ([]byte, []MultipartUploadComponent, error) {
+	_, span := c.startSpan(ctx, "scan bundle")
+	article, err := bundle.Article()
+	var components []MultipartUploadComponent
+	if err == nil {
+		components, err = bundle.components(article)
+	}
+	span.SetAttributes(attribute.Int("apple_news.bundle_files", len(components)))
+	endSpan(span, err)
+	return article, components, err
+}
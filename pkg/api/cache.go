@@ -0,0 +1,139 @@
+package api
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+type cacheEntry struct {
+	Value    json.RawMessage `json:"value"`
+	StoredAt time.Time       `json:"storedAt"`
+}
+
+//Caches the responses of ReadChannel, ReadSection and ListSections for TTL. Channel and section info rarely changes,
+//so jobs that publish a lot don't need to spend their quota reading it over and over. When Path is set, the cache is
+//persisted there as JSON and shared by every client that loads it
+type MetadataCache struct {
+	TTL  time.Duration
+	Path string
+
+	mu      sync.Mutex
+	entries map[string]cacheEntry
+}
+
+//Creates a cache, loading the entries persisted at path if it isn't empty
+func NewMetadataCache(ttl time.Duration, path string) (*MetadataCache, error) {
+	cache := &MetadataCache{
+		TTL:     ttl,
+		Path:    path,
+		entries: make(map[string]cacheEntry),
+	}
+	if len(path) == 0 {
+		return cache, nil
+	}
+
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return cache, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, &cache.entries); err != nil {
+		return nil, errors.Wrapf(err, "reading metadata cache %s", path)
+	}
+	return cache, nil
+}
+
+func (m *MetadataCache) InvalidateChannel(channelId string) error {
+	return m.invalidate(channelCacheKey(channelId))
+}
+
+func (m *MetadataCache) InvalidateSection(sectionId string) error {
+	return m.invalidate(sectionCacheKey(sectionId))
+}
+
+func (m *MetadataCache) InvalidateSections(channelId string) error {
+	return m.invalidate(sectionsCacheKey(channelId))
+}
+
+//Drops every entry
+func (m *MetadataCache) Clear() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.entries = make(map[string]cacheEntry)
+	return m.save()
+}
+
+//Decodes the entry stored under key into v. Returns false when there is no entry or it is older than TTL
+func (m *MetadataCache) get(key string, v interface{}) bool {
+	m.mu.Lock()
+	entry, ok := m.entries[key]
+	m.mu.Unlock()
+
+	if !ok || time.Since(entry.StoredAt) > m.TTL {
+		return false
+	}
+	return json.Unmarshal(entry.Value, v) == nil
+}
+
+func (m *MetadataCache) put(key string, v interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.entries == nil {
+		m.entries = make(map[string]cacheEntry)
+	}
+	m.entries[key] = cacheEntry{Value: b, StoredAt: time.Now().UTC()}
+	return m.save()
+}
+
+func (m *MetadataCache) invalidate(key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.entries[key]; !ok {
+		return nil
+	}
+	delete(m.entries, key)
+	return m.save()
+}
+
+func (m *MetadataCache) save() error {
+	if len(m.Path) == 0 {
+		return nil
+	}
+	b, err := json.Marshal(m.entries)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(m.Path), 0755); err != nil {
+		return err
+	}
+	tmp := m.Path + ".tmp"
+	if err := ioutil.WriteFile(tmp, b, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, m.Path)
+}
+
+func channelCacheKey(channelId string) string {
+	return "channel/" + channelId
+}
+
+func sectionCacheKey(sectionId string) string {
+	return "section/" + sectionId
+}
+
+func sectionsCacheKey(channelId string) string {
+	return "sections/" + channelId
+}
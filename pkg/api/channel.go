@@ -1,7 +1,7 @@
 package api
 
 import (
-	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
@@ -25,21 +25,34 @@ type ReadChannelResponse struct {
 }
 
 func (c *Client) ReadChannel(channelId string) (*ReadChannelResponse, error) {
-	url := fmt.Sprintf("%s/channels/%s", c.BaseURL, channelId)
-	req, err := http.NewRequest(http.MethodGet, url, nil)
+	ctx, span := c.startSpan(c.context(), "ReadChannel", AttributeChannelID.String(channelId))
+	defer span.End()
+
+	if c.MetadataCache == nil {
+		return c.readChannel(ctx, channelId)
+	}
+
+	var cached ReadChannelResponse
+	if c.MetadataCache.get(channelCacheKey(channelId), &cached) {
+		return &cached, nil
+	}
+	resp, err := c.readChannel(ctx, channelId)
 	if err != nil {
 		return nil, err
 	}
+	//A cache that can't be persisted shouldn't fail a successful read
+	_ = c.MetadataCache.put(channelCacheKey(channelId), resp)
+	return resp, nil
+}
 
-	auth, err := c.getAuthorization(http.MethodGet, url, "", ioutil.NopCloser(bytes.NewReader([]byte{})))
+func (c *Client) readChannel(ctx context.Context, channelId string) (*ReadChannelResponse, error) {
+	url := fmt.Sprintf("%s/channels/%s", c.BaseURL, channelId)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
 	if err != nil {
 		return nil, err
 	}
-	req.Header.Set("Authorization", auth)
-
-	client := c.Client
 
-	resp, err := client.Do(req)
+	resp, err := c.do(req)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,93 @@
+package api
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+//The content types of the files Apple News accepts in a bundle, by extension
+var bundleContentTypes = map[string]ContentType{
+	".jpg":      ContentTypeJpeg,
+	".jpeg":     ContentTypeJpeg,
+	".png":      ContentTypePng,
+	".gif":      ContentTypeGif,
+	".webp":     ContentTypeWebp,
+	".ttf":      ContentTypeTtf,
+	".otf":      ContentTypeOtf,
+	".html":     ContentTypeHtml,
+	".css":      ContentTypeCss,
+	".js":       ContentTypeJs,
+	".manifest": ContentTypeManifest,
+}
+
+//Binary formats recognizable from their first bytes. Text formats can't be told apart that way, so those always go by
+//their extension
+var sniffableContentTypes = map[string]ContentType{
+	"image/jpeg": ContentTypeJpeg,
+	"image/png":  ContentTypePng,
+	"image/gif":  ContentTypeGif,
+	"image/webp": ContentTypeWebp,
+	"font/ttf":   ContentTypeTtf,
+	"font/otf":   ContentTypeOtf,
+}
+
+//Returned before anything is uploaded when a bundle holds files Apple News doesn't accept
+type UnsupportedContentError struct {
+	Files []string
+}
+
+func (e *UnsupportedContentError) Error() string {
+	return fmt.Sprintf("unsupported bundle files %s, supported are %s. Set a content type for them to upload them anyway",
+		strings.Join(e.Files, ", "), strings.Join(supportedExtensions(), ", "))
+}
+
+func GetContentType(extension string) (ContentType, error) {
+	if contentType, ok := bundleContentTypes[strings.ToLower(extension)]; ok {
+		return contentType, nil
+	}
+	return "", errors.New(fmt.Sprintf("Could not match extension %s to a valid content type", extension))
+}
+
+//Works out the content type of a bundle file. An override for its path or extension wins, then what its first bytes
+//say it is, so a PNG named .jpg is still uploaded as a PNG, and then its extension
+func DetectContentType(name string, header []byte, overrides map[string]ContentType) (ContentType, error) {
+	ext := strings.ToLower(path.Ext(name))
+	if contentType, ok := overrides[name]; ok {
+		return contentType, nil
+	}
+	if contentType, ok := overrides[ext]; ok {
+		return contentType, nil
+	}
+	if len(header) > 0 {
+		sniffed := http.DetectContentType(header)
+		if contentType, ok := sniffableContentTypes[strings.Split(sniffed, ";")[0]]; ok {
+			return contentType, nil
+		}
+	}
+	return GetContentType(ext)
+}
+
+//Reads the bytes DetectContentType looks at
+func readContentHeader(r io.Reader) ([]byte, error) {
+	header := make([]byte, 512)
+	n, err := io.ReadFull(r, header)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		err = nil
+	}
+	return header[:n], err
+}
+
+func supportedExtensions() []string {
+	var extensions []string
+	for ext := range bundleContentTypes {
+		extensions = append(extensions, ext)
+	}
+	sort.Strings(extensions)
+	return extensions
+}
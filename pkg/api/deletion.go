@@ -0,0 +1,442 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+//The metadata an article has, in the form UpdateArticleMetadata and CreateArticle take it
+func articleMetadata(article *ReadArticleResponse) *Data {
+	d := article.Data
+	return &Data{
+		Links:                   Links{Sections: d.Links.Sections},
+		AccessoryText:           d.AccessoryText,
+		MaturityRating:          d.MaturityRating,
+		IsCandidateToBeFeatured: d.IsCandidateToBeFeatured,
+		IsSponsored:             d.IsSponsored,
+		IsPreview:               d.IsPreview,
+		IsDevelopingStory:       d.IsDevelopingStory,
+		IsHidden:                d.IsHidden,
+	}
+}
+
+//The most bytes downloaded for one asset of a backed up article
+const maxBackupAssetBytes = 100 << 20
+
+//Component roles whose URL is an image. Other roles' URLs are videos, embeds or pages, and aren't downloaded
+var imageComponentRoles = map[string]bool{"photo": true, "image": true, "figure": true, "portrait": true, "logo": true}
+
+//A copy of an article saved before it was deleted
+type ArticleBackup struct {
+	ArticleID string    `json:"articleId"`
+	Title     string    `json:"title"`
+	Dir       string    `json:"dir"`
+	TakenAt   time.Time `json:"takenAt"`
+	//Paths of the downloaded assets relative to Dir
+	Assets []string `json:"assets,omitempty"`
+	//Assets that couldn't be downloaded, which article.json still references by URL
+	AssetErrors []string `json:"assetErrors,omitempty"`
+}
+
+//Saves the article to a new directory in dir as a bundle: its article.json and metadata.json, which can be passed to
+//create to bring it back, and article_response.json with everything the API returned for it. The images the API
+//serves for it are downloaded into assets, and article.json references them with bundle://, as the API's copies go
+//when the article does. Assets that fail to download are listed in AssetErrors rather than failing the backup
+func (c *Client) BackupArticle(articleId string, dir string) (*ArticleBackup, error) {
+	article, err := c.ReadArticle(articleId)
+	if err != nil {
+		return nil, err
+	}
+	if article.Data.Document == nil {
+		return nil, errors.Errorf("the API returned no document for article %s", articleId)
+	}
+
+	backup := &ArticleBackup{ArticleID: articleId, Title: article.Data.Title, TakenAt: c.Now().UTC()}
+	backup.Dir = filepath.Join(dir, articleId+"-"+backup.TakenAt.Format("20060102T150405Z"))
+	if err := os.MkdirAll(backup.Dir, 0755); err != nil {
+		return nil, err
+	}
+
+	//Rewritten in a copy, so article_response.json keeps the URLs the API returned
+	b, err := json.Marshal(article.Data.Document)
+	if err != nil {
+		return nil, err
+	}
+	var document interface{}
+	if err := json.Unmarshal(b, &document); err != nil {
+		return nil, err
+	}
+	document = c.backupAssets(document, backup)
+
+	files := map[string]interface{}{
+		"article.json":          document,
+		"metadata.json":         Metadata{Data: *articleMetadata(article)},
+		"article_response.json": article,
+	}
+	for name, v := range files {
+		b, err := json.MarshalIndent(v, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		if err := ioutil.WriteFile(filepath.Join(backup.Dir, name), b, 0644); err != nil {
+			return nil, err
+		}
+	}
+	return backup, nil
+}
+
+//Downloads the images the URL properties of the document point at into the backup, and returns the document with
+//those properties pointing at the copies instead. Link additions, and the URLs of videos and embeds, are left alone
+func (c *Client) backupAssets(document interface{}, backup *ArticleBackup) interface{} {
+	saved := make(map[string]string)
+	var walk func(v interface{}, key string) interface{}
+	walk = func(v interface{}, key string) interface{} {
+		switch v := v.(type) {
+		case string:
+			if !strings.HasSuffix(key, "URL") || !strings.HasPrefix(v, "http://") && !strings.HasPrefix(v, "https://") {
+				return v
+			}
+			if name, ok := saved[v]; ok {
+				return "bundle://" + name
+			}
+			name, err := c.downloadAsset(v, backup.Dir, len(saved)+1)
+			if err != nil {
+				backup.AssetErrors = append(backup.AssetErrors, err.Error())
+				return v
+			}
+			if len(name) == 0 {
+				return v
+			}
+			saved[v] = name
+			backup.Assets = append(backup.Assets, name)
+			return "bundle://" + name
+		case []interface{}:
+			for i := range v {
+				v[i] = walk(v[i], key)
+			}
+		case map[string]interface{}:
+			role, _ := v["role"].(string)
+			//Sorted so assets are numbered the same way every time
+			keys := make([]string, 0, len(v))
+			for k := range v {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			for _, k := range keys {
+				if k == "additions" || k == "URL" && len(role) > 0 && !imageComponentRoles[role] {
+					continue
+				}
+				v[k] = walk(v[k], k)
+			}
+		}
+		return v
+	}
+	return walk(document, "")
+}
+
+//Saves the file at url as assets/<n> in dir, named with the extension of its type, and returns its path relative to
+//dir. Returns "" when it isn't a type a bundle can hold, such as a page a link points at
+func (c *Client) downloadAsset(url string, dir string, n int) (string, error) {
+	req, err := http.NewRequestWithContext(c.context(), http.MethodGet, url, nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := c.Client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", errors.Errorf("%s returned a %d", url, resp.StatusCode)
+	}
+	b, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxBackupAssetBytes+1))
+	if err != nil {
+		return "", errors.Wrap(err, url)
+	}
+	if len(b) > maxBackupAssetBytes {
+		return "", errors.Errorf("%s is larger than %d bytes", url, maxBackupAssetBytes)
+	}
+
+	ext := ""
+	switch ContentType(strings.Split(http.DetectContentType(b), ";")[0]) {
+	case ContentTypeJpeg:
+		ext = ".jpg"
+	case ContentTypePng:
+		ext = ".png"
+	case ContentTypeGif:
+		ext = ".gif"
+	case ContentTypeWebp:
+		ext = ".webp"
+	default:
+		return "", nil
+	}
+
+	name := fmt.Sprintf("assets/%d%s", n, ext)
+	if err := os.MkdirAll(filepath.Join(dir, "assets"), 0755); err != nil {
+		return "", err
+	}
+	return name, ioutil.WriteFile(filepath.Join(dir, filepath.FromSlash(name)), b, 0644)
+}
+
+//Hides the article from readers or shows it again, keeping the rest of its metadata
+func (c *Client) HideArticle(articleId string, hidden bool) (*ReadArticleResponse, error) {
+	article, err := c.ReadArticle(articleId)
+	if err != nil {
+		return nil, err
+	}
+	metadata := &Metadata{Data: *articleMetadata(article)}
+	metadata.Data.IsHidden = hidden
+	metadata.Data.Revision = article.Data.Revision
+	return c.UpdateArticleMetadata(articleId, metadata)
+}
+
+//An article that was hidden instead of deleted, and is deleted for good once PurgeAt passes
+type SoftDeletion struct {
+	ArticleID string    `json:"articleId"`
+	Title     string    `json:"title,omitempty"`
+	HiddenAt  time.Time `json:"hiddenAt"`
+	PurgeAt   time.Time `json:"purgeAt"`
+	Operator  string    `json:"operator,omitempty"`
+}
+
+//The outcome of purging one soft deleted article
+type PurgeResult struct {
+	ArticleID string `json:"articleId"`
+	Title     string `json:"title,omitempty"`
+	//The article had been shown again other than through Restore, so it was kept and its deletion dropped
+	Kept  bool   `json:"kept,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+//Deletes articles softly: they are hidden at once and deleted by a later Tick, so they can be restored until then.
+//The pending deletions are persisted as JSON at Path, so any process calling Tick sees the same ones. Processes lock
+//Path.lock while they read and change them, so a purge daemon and a delete running at once don't drop each other's
+//entries
+type SoftDeletions struct {
+	Client   *Client
+	Path     string
+	Operator string
+
+	mu sync.Mutex
+}
+
+func NewSoftDeletions(c *Client, path string, operator string) *SoftDeletions {
+	return &SoftDeletions{
+		Client:   c,
+		Path:     path,
+		Operator: operator,
+	}
+}
+
+//Hides the article, and deletes it on the first Tick after grace has passed. When the deletion can't be saved the
+//article is shown again, so it isn't left hidden with nothing to purge or restore it
+func (s *SoftDeletions) Delete(articleId string, grace time.Duration) (*SoftDeletion, error) {
+	article, err := s.Client.HideArticle(articleId, true)
+	if err != nil {
+		return nil, err
+	}
+	now := s.Client.Now().UTC()
+	entry := SoftDeletion{
+		ArticleID: articleId,
+		Title:     article.Data.Title,
+		HiddenAt:  now,
+		PurgeAt:   now.Add(grace),
+		Operator:  s.Operator,
+	}
+
+	if err := s.save(entry); err != nil {
+		if _, showErr := s.Client.HideArticle(articleId, false); showErr != nil {
+			return nil, errors.Errorf("article %s is hidden but its deletion couldn't be saved (%s), and showing it again failed: %s", articleId, err, showErr)
+		}
+		return nil, errors.Wrapf(err, "article %s was shown again as its deletion couldn't be saved", articleId)
+	}
+	return &entry, nil
+}
+
+func (s *SoftDeletions) save(entry SoftDeletion) error {
+	unlock, err := s.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	entries, err := s.readEntries()
+	if err != nil {
+		return err
+	}
+	return s.writeEntries(append(withoutSoftDeletion(entries, entry.ArticleID), entry))
+}
+
+//Shows a soft deleted article again and cancels its deletion
+func (s *SoftDeletions) Restore(articleId string) (*ReadArticleResponse, error) {
+	unlock, err := s.lock()
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	entries, err := s.readEntries()
+	if err != nil {
+		return nil, err
+	}
+	if len(withoutSoftDeletion(entries, articleId)) == len(entries) {
+		return nil, errors.Errorf("article %s isn't waiting to be deleted", articleId)
+	}
+	article, err := s.Client.HideArticle(articleId, false)
+	if err != nil {
+		return nil, err
+	}
+	return article, s.writeEntries(withoutSoftDeletion(entries, articleId))
+}
+
+//Returns the pending deletions ordered by when they are purged
+func (s *SoftDeletions) Entries() ([]SoftDeletion, error) {
+	unlock, err := s.lock()
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	return s.readEntries()
+}
+
+//Deletes every article whose grace period is over as of now. Articles that fail keep their entries so the next tick
+//retries them. Each article is read first, and one that was shown again, e.g. through its metadata, is kept and
+//its entry dropped
+func (s *SoftDeletions) Tick(now time.Time) ([]PurgeResult, error) {
+	unlock, err := s.lock()
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	entries, err := s.readEntries()
+	if err != nil {
+		return nil, err
+	}
+
+	var results []PurgeResult
+	for _, e := range entries {
+		if e.PurgeAt.After(now) {
+			continue
+		}
+		result := PurgeResult{ArticleID: e.ArticleID, Title: e.Title}
+		article, err := s.Client.ReadArticle(e.ArticleID)
+		switch {
+		case err != nil:
+			result.Error = err.Error()
+		case !article.Data.IsHidden:
+			result.Kept = true
+			entries = withoutSoftDeletion(entries, e.ArticleID)
+		default:
+			if err := s.Client.DeleteArticle(e.ArticleID); err != nil {
+				result.Error = err.Error()
+			} else {
+				entries = withoutSoftDeletion(entries, e.ArticleID)
+			}
+		}
+		results = append(results, result)
+	}
+	return results, s.writeEntries(entries)
+}
+
+//Calls Tick every interval until the context is done. Each round's results are passed to onTick when it isn't nil
+func (s *SoftDeletions) Run(ctx context.Context, interval time.Duration, onTick func([]PurgeResult, error)) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		results, err := s.Tick(s.Client.Now())
+		if onTick != nil {
+			onTick(results, err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+//Locks the pending deletions against the other goroutines of this process, and through Path.lock against other
+//processes. Returns the function that unlocks them
+func (s *SoftDeletions) lock() (func(), error) {
+	s.mu.Lock()
+	unlockFile, err := lockFile(s.Path + ".lock")
+	if err != nil {
+		s.mu.Unlock()
+		return nil, err
+	}
+	return func() {
+		unlockFile()
+		s.mu.Unlock()
+	}, nil
+}
+
+func (s *SoftDeletions) readEntries() ([]SoftDeletion, error) {
+	b, err := ioutil.ReadFile(s.Path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var entries []SoftDeletion
+	return entries, json.Unmarshal(b, &entries)
+}
+
+func (s *SoftDeletions) writeEntries(entries []SoftDeletion) error {
+	if entries == nil {
+		entries = []SoftDeletion{}
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].PurgeAt.Before(entries[j].PurgeAt)
+	})
+	b, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.Path), 0755); err != nil {
+		return err
+	}
+
+	//Write to a temporary file first so a crash never leaves a truncated file behind. Its name is unique, so a process
+	//that didn't take the lock can't write to it at the same time
+	tmp, err := ioutil.TempFile(filepath.Dir(s.Path), filepath.Base(s.Path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.Write(b)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(tmp.Name(), 0644)
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), s.Path)
+}
+
+func withoutSoftDeletion(entries []SoftDeletion, articleId string) []SoftDeletion {
+	result := make([]SoftDeletion, 0, len(entries))
+	for _, e := range entries {
+		if e.ArticleID != articleId {
+			result = append(result, e)
+		}
+	}
+	return result
+}
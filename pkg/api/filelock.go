@@ -0,0 +1,29 @@
+//go:build !windows && !plan9
+
+package api
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+//Takes an exclusive lock on the file at path, creating it, and waits while another process holds it. Returns the
+//function that releases it
+func lockFile(path string) (func(), error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, err
+	}
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return func() {
+		syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+		f.Close()
+	}, nil
+}
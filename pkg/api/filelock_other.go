@@ -0,0 +1,8 @@
+//go:build windows || plan9
+
+package api
+
+//There is no flock on this platform, so only the locks within a process keep files from being written at once
+func lockFile(path string) (func(), error) {
+	return func() {}, nil
+}
@@ -0,0 +1,238 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"golang.org/x/image/font/sfnt"
+)
+
+//Font families that come with iOS and macOS, so articles can use them without bundling anything
+var systemFontFamilies = map[string]bool{
+	"AcademyEngravedLetPlain": true, "AmericanTypewriter": true, "Arial": true, "ArialHebrew": true,
+	"ArialMT": true, "ArialRoundedMTBold": true, "Avenir": true, "AvenirNext": true, "AvenirNextCondensed": true,
+	"Baskerville": true, "BodoniSvtyTwoITCTT": true, "BodoniSvtyTwoOSITCTT": true, "BradleyHandITCTT": true,
+	"ChalkboardSE": true, "Chalkduster": true, "Charter": true, "Cochin": true, "Copperplate": true,
+	"Courier": true, "CourierNewPSMT": true, "CourierNewPS": true, "Didot": true, "DINAlternate": true,
+	"DINCondensed": true, "Futura": true, "Georgia": true, "GillSans": true, "Helvetica": true,
+	"HelveticaNeue": true, "HoeflerText": true, "IowanOldStyle": true, "MarkerFelt": true, "Menlo": true,
+	"Noteworthy": true, "Optima": true, "Palatino": true, "Papyrus": true, "PartyLetPlain": true,
+	"SavoyeLetPlain": true, "SnellRoundhand": true, "Superclarendon": true, "Symbol": true,
+	"TimesNewRomanPS": true, "TimesNewRomanPSMT": true, "TrebuchetMS": true, "Verdana": true, "Zapfino": true,
+	"SFProText": true, "SFProDisplay": true, "SFProRounded": true, "SFMono": true, "NewYork": true,
+	"NewYorkSmall": true, "NewYorkMedium": true, "NewYorkLarge": true,
+}
+
+//A custom font article.json uses that is uploaded with the bundle
+type BundleFont struct {
+	//The PostScript name text styles refer to the font by
+	FontName string `json:"fontName"`
+	//The file name the font is uploaded as, its path in the bundle or relative to the font directory
+	Path        string `json:"path"`
+	FromFontDir bool   `json:"fromFontDir,omitempty"`
+
+	data []byte
+}
+
+//Reports whether a PostScript font name, such as HelveticaNeue-Bold, belongs to a font that comes with the system
+func IsSystemFont(fontName string) bool {
+	return systemFontFamilies[strings.SplitN(fontName, "-", 2)[0]]
+}
+
+//Collects the fontName of every text style in article.json, wherever it is defined, once each and sorted
+func ScanFontNames(articleJson []byte) ([]string, error) {
+	var doc interface{}
+	if err := json.Unmarshal(articleJson, &doc); err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool)
+	var walk func(v interface{})
+	walk = func(v interface{}) {
+		switch v := v.(type) {
+		case []interface{}:
+			for _, e := range v {
+				walk(e)
+			}
+		case map[string]interface{}:
+			for k, e := range v {
+				if name, ok := e.(string); ok && k == "fontName" && len(name) > 0 {
+					seen[name] = true
+				}
+				walk(e)
+			}
+		}
+	}
+	walk(doc)
+
+	names := make([]string, 0, len(seen))
+	for name := range seen {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+//A font file that might provide a font, in the bundle or the font directory
+type fontCandidate struct {
+	path        string
+	fromFontDir bool
+	open        func() (io.ReadCloser, error)
+}
+
+//Resolves the custom fonts article.json uses, looking in the bundle first and then in FontDir. A file named after the
+//font is tried before any other, and every file is validated as a TrueType or OpenType font
+func (b *Bundle) scanFonts(articleJson []byte, scan *BundleScan) error {
+	names, err := ScanFontNames(articleJson)
+	if err != nil {
+		return err
+	}
+
+	var candidates []fontCandidate
+	loaded := false
+	var byName map[string]*BundleFont
+	for _, fontName := range names {
+		if IsSystemFont(fontName) {
+			continue
+		}
+		if !loaded {
+			if candidates, err = b.fontCandidates(); err != nil {
+				return err
+			}
+			loaded = true
+		}
+
+		if font := b.fontByFileName(fontName, candidates, scan); font != nil {
+			addFont(scan, font)
+			continue
+		}
+		if byName == nil {
+			byName = b.indexFonts(candidates, scan)
+		}
+		if font, ok := byName[fontName]; ok {
+			addFont(scan, font)
+			continue
+		}
+		scan.FontProblems = append(scan.FontProblems, fmt.Sprintf("font %s is neither a system font nor in the bundle or font directory", fontName))
+	}
+	return nil
+}
+
+//Adds the font unless its file already provides another fontName, as each file is uploaded once
+func addFont(scan *BundleScan, font *BundleFont) {
+	for _, f := range scan.Fonts {
+		if f.Path == font.Path {
+			return
+		}
+	}
+	scan.Fonts = append(scan.Fonts, *font)
+}
+
+func (b *Bundle) fontByFileName(fontName string, candidates []fontCandidate, scan *BundleScan) *BundleFont {
+	for _, c := range candidates {
+		if strings.TrimSuffix(path.Base(c.path), path.Ext(c.path)) != fontName {
+			continue
+		}
+		font, err := loadFont(c)
+		if err != nil {
+			scan.FontProblems = append(scan.FontProblems, err.Error())
+			continue
+		}
+		font.FontName = fontName
+		return font
+	}
+	return nil
+}
+
+//Reads the PostScript name of every candidate. Invalid files are reported once, here or in fontByFileName
+func (b *Bundle) indexFonts(candidates []fontCandidate, scan *BundleScan) map[string]*BundleFont {
+	reported := make(map[string]bool)
+	for _, p := range scan.FontProblems {
+		reported[p] = true
+	}
+
+	byName := make(map[string]*BundleFont)
+	for _, c := range candidates {
+		font, err := loadFont(c)
+		if err != nil {
+			if !reported[err.Error()] {
+				scan.FontProblems = append(scan.FontProblems, err.Error())
+			}
+			continue
+		}
+		if _, ok := byName[font.FontName]; !ok {
+			byName[font.FontName] = font
+		}
+	}
+	return byName
+}
+
+func (b *Bundle) fontCandidates() ([]fontCandidate, error) {
+	var candidates []fontCandidate
+	for _, name := range b.Files() {
+		if isFontFile(name) {
+			candidates = append(candidates, fontCandidate{path: name, open: b.files[name]})
+		}
+	}
+	if len(b.FontDir) == 0 {
+		return candidates, nil
+	}
+
+	err := filepath.Walk(b.FontDir, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || !isFontFile(p) {
+			return nil
+		}
+		rel, err := filepath.Rel(b.FontDir, p)
+		if err != nil {
+			return err
+		}
+		file := p
+		candidates = append(candidates, fontCandidate{
+			path:        filepath.ToSlash(rel),
+			fromFontDir: true,
+			open: func() (io.ReadCloser, error) {
+				return os.Open(file)
+			},
+		})
+		return nil
+	})
+	return candidates, err
+}
+
+func loadFont(c fontCandidate) (*BundleFont, error) {
+	f, err := c.open()
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	data, err := ioutil.ReadAll(f)
+	if err != nil {
+		return nil, err
+	}
+
+	parsed, err := sfnt.Parse(data)
+	if err != nil {
+		return nil, errors.Errorf("%s isn't a valid TrueType or OpenType font: %s", c.path, err)
+	}
+	name, err := parsed.Name(nil, sfnt.NameIDPostScript)
+	if err != nil {
+		return nil, errors.Errorf("%s has no PostScript name: %s", c.path, err)
+	}
+	return &BundleFont{FontName: name, Path: c.path, FromFontDir: c.fromFontDir, data: data}, nil
+}
+
+func isFontFile(name string) bool {
+	ext := strings.ToLower(path.Ext(name))
+	return ext == ".ttf" || ext == ".otf"
+}
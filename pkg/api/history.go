@@ -0,0 +1,91 @@
+package api
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+//A single notification that was successfully sent, as recorded in the notification log
+type NotificationLogEntry struct {
+	ArticleID  string    `json:"articleId"`
+	AlertBody  string    `json:"alertBody"`
+	Countries  []string  `json:"countries,omitempty"`
+	ResponseID string    `json:"responseId"`
+	SentAt     time.Time `json:"sentAt"`
+	Operator   string    `json:"operator,omitempty"`
+}
+
+//An append-only JSON lines log of sent notifications. When DedupeWindow is greater than zero, sending another
+//notification for an article that was notified within the window is refused with a DuplicateNotificationError
+type NotificationLog struct {
+	Path         string
+	DedupeWindow time.Duration
+	Operator     string
+
+	mu sync.Mutex
+}
+
+type DuplicateNotificationError struct {
+	Previous NotificationLogEntry
+	Window   time.Duration
+}
+
+func (e *DuplicateNotificationError) Error() string {
+	return fmt.Sprintf("a notification for article %s was already sent at %s by %q (dedupe window is %s)",
+		e.Previous.ArticleID, e.Previous.SentAt.Format(time.RFC3339), e.Previous.Operator, e.Window)
+}
+
+func NewNotificationLog(path string, dedupeWindow time.Duration, operator string) *NotificationLog {
+	return &NotificationLog{
+		Path:         path,
+		DedupeWindow: dedupeWindow,
+		Operator:     operator,
+	}
+}
+
+//Returns every entry in the log, oldest first. A missing log file is treated as empty
+func (l *NotificationLog) Entries() ([]NotificationLogEntry, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return readJSONLines[NotificationLogEntry](l.Path)
+}
+
+//Returns the most recent entry for the article, or nil if it was never notified
+func (l *NotificationLog) LastSent(articleId string) (*NotificationLogEntry, error) {
+	entries, err := l.Entries()
+	if err != nil {
+		return nil, err
+	}
+	for i := len(entries) - 1; i >= 0; i-- {
+		if entries[i].ArticleID == articleId {
+			return &entries[i], nil
+		}
+	}
+	return nil, nil
+}
+
+//Returns a DuplicateNotificationError if the article was notified within the dedupe window as of now
+func (l *NotificationLog) CheckDuplicate(articleId string, now time.Time) error {
+	if l.DedupeWindow <= 0 {
+		return nil
+	}
+	last, err := l.LastSent(articleId)
+	if err != nil {
+		return err
+	}
+	if last != nil && now.Sub(last.SentAt) < l.DedupeWindow {
+		return &DuplicateNotificationError{Previous: *last, Window: l.DedupeWindow}
+	}
+	return nil
+}
+
+func (l *NotificationLog) Append(entry NotificationLogEntry) error {
+	if len(entry.Operator) == 0 {
+		entry.Operator = l.Operator
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return appendJSONLine(l.Path, entry)
+}
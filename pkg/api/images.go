@@ -0,0 +1,323 @@
+package api
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+	"golang.org/x/image/draw"
+)
+
+const (
+	//The longest side worth uploading, as wide as the largest screens Apple News renders articles on
+	DefaultMaxImageDimension = 2732
+	DefaultJpegQuality       = 85
+)
+
+//Prepares the JPEG and PNG images of a bundle for upload. Images larger than MaxDimension are scaled down, all of them
+//are recompressed when that makes them smaller, and metadata such as EXIF and GPS positions is stripped. JPEGs are
+//turned upright first, since that is what their EXIF orientation was for. Other files, animated PNGs included, are
+//uploaded as they are
+type ImageProcessor struct {
+	MaxDimension int
+	JpegQuality  int
+	//Processed images are kept here, keyed by a hash of the original and the settings, so each is processed once.
+	//Nothing is cached when empty
+	CacheDir string
+}
+
+func NewImageProcessor(cacheDir string) *ImageProcessor {
+	return &ImageProcessor{
+		MaxDimension: DefaultMaxImageDimension,
+		JpegQuality:  DefaultJpegQuality,
+		CacheDir:     cacheDir,
+	}
+}
+
+//Returns the parts with the data of their JPEG and PNG images replaced by the processed versions
+func (p *ImageProcessor) Process(parts []MultipartUploadComponent) ([]MultipartUploadComponent, error) {
+	processed := make([]MultipartUploadComponent, 0, len(parts))
+	for _, part := range parts {
+		if part.ContentType != ContentTypeJpeg && part.ContentType != ContentTypePng {
+			processed = append(processed, part)
+			continue
+		}
+		original, err := ioutil.ReadAll(part.Data)
+		if err != nil {
+			return nil, errors.Wrap(err, part.FileName)
+		}
+		b, err := p.ProcessImage(original, part.ContentType)
+		if err != nil {
+			return nil, errors.Wrap(err, part.FileName)
+		}
+		part.Data = bytes.NewReader(b)
+		processed = append(processed, part)
+	}
+	return processed, nil
+}
+
+//Processes a single JPEG or PNG image, going through the cache when there is one
+func (p *ImageProcessor) ProcessImage(b []byte, contentType ContentType) ([]byte, error) {
+	key := sha256.New()
+	fmt.Fprintf(key, "%s\x00%d\x00%d\x00", contentType, p.MaxDimension, p.JpegQuality)
+	key.Write(b)
+	cachePath := ""
+	if len(p.CacheDir) > 0 {
+		cachePath = filepath.Join(p.CacheDir, hex.EncodeToString(key.Sum(nil)))
+		if cached, err := ioutil.ReadFile(cachePath); err == nil {
+			return cached, nil
+		}
+	}
+
+	var processed []byte
+	var err error
+	switch contentType {
+	case ContentTypeJpeg:
+		processed, err = p.processJpeg(b)
+	case ContentTypePng:
+		processed, err = p.processPng(b)
+	default:
+		return b, nil
+	}
+	if err != nil || len(cachePath) == 0 {
+		return processed, err
+	}
+
+	if err := os.MkdirAll(p.CacheDir, 0755); err != nil {
+		return nil, err
+	}
+	tmp := cachePath + ".tmp"
+	if err := ioutil.WriteFile(tmp, processed, 0644); err != nil {
+		return nil, err
+	}
+	return processed, os.Rename(tmp, cachePath)
+}
+
+func (p *ImageProcessor) processJpeg(b []byte) ([]byte, error) {
+	orientation := jpegOrientation(b)
+	stripped := stripJpegMetadata(b)
+	img, err := jpeg.Decode(bytes.NewReader(stripped))
+	if err != nil {
+		return nil, err
+	}
+
+	resized := p.resize(orient(img, orientation))
+	var out bytes.Buffer
+	if err := jpeg.Encode(&out, resized, &jpeg.Options{Quality: p.JpegQuality}); err != nil {
+		return nil, err
+	}
+	//Recompressing an image that needed neither turning nor scaling is only worth it when it saves something
+	if resized == img && orientation <= 1 && out.Len() >= len(stripped) {
+		return stripped, nil
+	}
+	return out.Bytes(), nil
+}
+
+func (p *ImageProcessor) processPng(b []byte) ([]byte, error) {
+	stripped, animated := stripPngMetadata(b)
+	if animated {
+		return stripped, nil
+	}
+	img, err := png.Decode(bytes.NewReader(stripped))
+	if err != nil {
+		return nil, err
+	}
+
+	resized := p.resize(img)
+	var out bytes.Buffer
+	encoder := png.Encoder{CompressionLevel: png.BestCompression}
+	if err := encoder.Encode(&out, resized); err != nil {
+		return nil, err
+	}
+	if resized == img && out.Len() >= len(stripped) {
+		return stripped, nil
+	}
+	return out.Bytes(), nil
+}
+
+//Scales the image down so its longest side is MaxDimension, returning it as is when it already fits
+func (p *ImageProcessor) resize(img image.Image) image.Image {
+	bounds := img.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	if p.MaxDimension <= 0 || (w <= p.MaxDimension && h <= p.MaxDimension) {
+		return img
+	}
+	if w >= h {
+		w, h = p.MaxDimension, h*p.MaxDimension/w
+	} else {
+		w, h = w*p.MaxDimension/h, p.MaxDimension
+	}
+	if w < 1 {
+		w = 1
+	}
+	if h < 1 {
+		h = 1
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, bounds, draw.Src, nil)
+	return dst
+}
+
+//Applies an EXIF orientation, returning an image that displays upright without it
+func orient(img image.Image, orientation int) image.Image {
+	if orientation <= 1 || orientation > 8 {
+		return img
+	}
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	dw, dh := w, h
+	if orientation >= 5 {
+		dw, dh = h, w
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < dh; y++ {
+		for x := 0; x < dw; x++ {
+			var sx, sy int
+			switch orientation {
+			case 2:
+				sx, sy = w-1-x, y
+			case 3:
+				sx, sy = w-1-x, h-1-y
+			case 4:
+				sx, sy = x, h-1-y
+			case 5:
+				sx, sy = y, x
+			case 6:
+				sx, sy = y, h-1-x
+			case 7:
+				sx, sy = w-1-y, h-1-x
+			case 8:
+				sx, sy = w-1-y, x
+			}
+			dst.Set(x, y, img.At(b.Min.X+sx, b.Min.Y+sy))
+		}
+	}
+	return dst
+}
+
+//Reads the orientation from the EXIF data of a JPEG, 1 meaning upright
+func jpegOrientation(b []byte) int {
+	for i := 2; i+4 <= len(b) && b[i] == 0xFF; {
+		marker := b[i+1]
+		if marker == 0xDA || marker == 0xD9 {
+			break
+		}
+		//The length counts its own 2 bytes, so anything shorter is a corrupt segment
+		end := i + 2 + int(binary.BigEndian.Uint16(b[i+2:]))
+		if end < i+4 || end > len(b) {
+			break
+		}
+		segment := b[i+4 : end]
+		if marker == 0xE1 && bytes.HasPrefix(segment, []byte("Exif\x00\x00")) {
+			return tiffOrientation(segment[6:])
+		}
+		i = end
+	}
+	return 1
+}
+
+func tiffOrientation(t []byte) int {
+	if len(t) < 8 {
+		return 1
+	}
+	var order binary.ByteOrder
+	switch string(t[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 1
+	}
+	ifd := int(order.Uint32(t[4:8]))
+	if ifd < 0 || ifd+2 > len(t) {
+		return 1
+	}
+	for j := 0; j < int(order.Uint16(t[ifd:])); j++ {
+		entry := ifd + 2 + j*12
+		if entry+12 > len(t) {
+			break
+		}
+		if order.Uint16(t[entry:]) == 0x0112 {
+			if o := int(order.Uint16(t[entry+8:])); o >= 1 && o <= 8 {
+				return o
+			}
+			return 1
+		}
+	}
+	return 1
+}
+
+//Drops the EXIF, XMP, IPTC and comment segments of a JPEG without recompressing it. The JFIF header, the color
+//profile and the Adobe segment CMYK images need are kept
+func stripJpegMetadata(b []byte) []byte {
+	if len(b) < 4 || b[0] != 0xFF || b[1] != 0xD8 {
+		return b
+	}
+	out := append([]byte{}, b[:2]...)
+	i := 2
+	for i+4 <= len(b) && b[i] == 0xFF {
+		marker := b[i+1]
+		if marker == 0xDA {
+			break
+		}
+		end := i + 2 + int(binary.BigEndian.Uint16(b[i+2:]))
+		if end < i+4 || end > len(b) {
+			return b
+		}
+		keep := true
+		switch {
+		case marker == 0xE2:
+			keep = bytes.HasPrefix(b[i+4:end], []byte("ICC_PROFILE"))
+		case marker == 0xFE, marker >= 0xE1 && marker <= 0xEF && marker != 0xEE:
+			keep = false
+		}
+		if keep {
+			out = append(out, b[i:end]...)
+		}
+		i = end
+	}
+	return append(out, b[i:]...)
+}
+
+//Chunks of a PNG that affect how it looks and are kept when stripping. Everything else that isn't critical, such as
+//text, EXIF and timestamps, is dropped
+var pngAppearanceChunks = map[string]bool{
+	"tRNS": true, "gAMA": true, "cHRM": true, "sRGB": true, "iCCP": true, "sBIT": true, "pHYs": true,
+	"acTL": true, "fcTL": true, "fdAT": true,
+}
+
+//Drops the metadata chunks of a PNG, and reports whether it is animated, which the png package can't encode
+func stripPngMetadata(b []byte) ([]byte, bool) {
+	const signature = "\x89PNG\r\n\x1a\n"
+	if !bytes.HasPrefix(b, []byte(signature)) {
+		return b, false
+	}
+	out := append([]byte{}, signature...)
+	animated := false
+	for i := len(signature); i+12 <= len(b); {
+		//Compared as uint64 so a huge length can't overflow int on 32 bit platforms
+		length := uint64(binary.BigEndian.Uint32(b[i:]))
+		if length > uint64(len(b)-i-12) {
+			return b, animated
+		}
+		end := i + 12 + int(length)
+		chunkType := string(b[i+4 : i+8])
+		animated = animated || chunkType == "acTL"
+		if chunkType[0] >= 'A' && chunkType[0] <= 'Z' || pngAppearanceChunks[chunkType] {
+			out = append(out, b[i:end]...)
+		}
+		i = end
+	}
+	return out, animated
+}
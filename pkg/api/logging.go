@@ -0,0 +1,175 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+const redacted = "[REDACTED]"
+
+//Receives structured log records, with args alternating between keys and values. *slog.Logger is one
+type Logger interface {
+	Info(msg string, args ...interface{})
+	Debug(msg string, args ...interface{})
+}
+
+//Headers Apple and the proxies in front of it identify a request by, logged when present
+var requestIDHeaders = []string{"X-Apple-Request-Uuid", "X-Apple-Jingle-Correlation-Key", "X-Request-Id"}
+
+//Logs every request sent through it to logger: a summary at info level and, with logBodies, the full request and
+//response at debug level. Add it last with Use, so it logs requests as they are sent. Request bodies are read through
+//GetBody, which the Client sets. The Authorization header and the secrets given, such as the API secret, never appear
+//in either
+func LoggingMiddleware(logger Logger, logBodies bool, secrets ...string) Middleware {
+	l := &requestLogger{logger: logger, logBodies: logBodies, secrets: secrets}
+	return func(next Doer) Doer {
+		return DoerFunc(func(req *http.Request) (*http.Response, error) {
+			return l.send(next, req)
+		})
+	}
+}
+
+type requestLogger struct {
+	logger    Logger
+	logBodies bool
+	secrets   []string
+}
+
+func (l *requestLogger) send(next Doer, req *http.Request) (*http.Response, error) {
+	if l.logBodies {
+		l.logger.Debug("request", "method", req.Method, "url", l.redact(req.URL.String()),
+			"headers", l.redactHeaders(req.Header), "body", l.redact(dumpRequestBody(req)))
+	}
+
+	start := time.Now()
+	resp, err := next.Do(req)
+	latency := time.Since(start)
+	if err != nil {
+		l.logger.Info("request failed", "method", req.Method, "path", req.URL.Path, "latency", latency, "error", l.redact(err.Error()))
+		return nil, err
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+	if err != nil {
+		return resp, err
+	}
+
+	args := []interface{}{"method", req.Method, "path", req.URL.Path, "status", resp.StatusCode, "latency", latency, "responseBytes", len(body)}
+	if IsRetry(req) {
+		args = append(args, "retry", true)
+	}
+	for _, h := range requestIDHeaders {
+		if id := resp.Header.Get(h); len(id) > 0 {
+			args = append(args, "requestId", id)
+			break
+		}
+	}
+	var meta struct {
+		Meta Meta `json:"meta"`
+	}
+	if json.Unmarshal(body, &meta) == nil && meta.Meta.Throttling != (Meta{}).Throttling {
+		t := meta.Meta.Throttling
+		args = append(args, "throttled", t.IsThrottled, "quotaAvailable", t.QuotaAvailable, "queueSize", t.QueueSize,
+			"estimatedDelaySeconds", t.EstimatedDelayInSeconds)
+	}
+	l.logger.Info("request", args...)
+
+	if l.logBodies {
+		l.logger.Debug("response", "status", resp.StatusCode, "headers", l.redactHeaders(resp.Header),
+			"body", l.redact(dumpBody(resp.Header.Get("Content-Type"), body)))
+	}
+	return resp, nil
+}
+
+func (l *requestLogger) redact(s string) string {
+	for _, secret := range l.secrets {
+		if len(secret) > 0 {
+			s = strings.Replace(s, secret, redacted, -1)
+		}
+	}
+	return s
+}
+
+func (l *requestLogger) redactHeaders(headers http.Header) string {
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var lines []string
+	for _, name := range names {
+		value := strings.Join(headers[name], ", ")
+		if http.CanonicalHeaderKey(name) == "Authorization" {
+			value = redacted
+		}
+		lines = append(lines, name+": "+l.redact(value))
+	}
+	return strings.Join(lines, "\n")
+}
+
+func dumpRequestBody(req *http.Request) string {
+	if req.GetBody == nil {
+		return ""
+	}
+	rc, err := req.GetBody()
+	if err != nil {
+		return ""
+	}
+	defer rc.Close()
+	body, _ := ioutil.ReadAll(rc)
+	return dumpBody(req.Header.Get("Content-Type"), body)
+}
+
+//Shows text as is and every part of a multipart body on its own, replacing binary content such as images with its size
+func dumpBody(contentType string, body []byte) string {
+	mediaType, params, _ := mime.ParseMediaType(contentType)
+	if !strings.HasPrefix(mediaType, "multipart/") {
+		return dumpContent(mediaType, body)
+	}
+
+	var b strings.Builder
+	r := multipart.NewReader(bytes.NewReader(body), params["boundary"])
+	for {
+		part, err := r.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			fmt.Fprintf(&b, "<unreadable multipart body: %s>\n", err)
+			break
+		}
+		content, _ := ioutil.ReadAll(part)
+		partType := part.Header.Get("Content-Type")
+		fmt.Fprintf(&b, "--- %s (%s)\n%s\n", part.Header.Get("Content-Disposition"), partType, dumpContent(partType, content))
+	}
+	return b.String()
+}
+
+func dumpContent(contentType string, content []byte) string {
+	if len(content) == 0 {
+		return ""
+	}
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	if len(mediaType) == 0 {
+		mediaType = http.DetectContentType(content)
+		mediaType, _, _ = mime.ParseMediaType(mediaType)
+	}
+	switch {
+	case strings.HasPrefix(mediaType, "text/"), strings.HasSuffix(mediaType, "json"), strings.HasSuffix(mediaType, "javascript"):
+		return string(content)
+	default:
+		return fmt.Sprintf("<%d bytes of %s elided>", len(content), mediaType)
+	}
+}
@@ -0,0 +1,103 @@
+package api
+
+import (
+	"context"
+	"net/http"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+//Sends HTTP requests, like *http.Client does
+type Doer interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
+//Lets a plain function be used as a Doer
+type DoerFunc func(req *http.Request) (*http.Response, error)
+
+func (f DoerFunc) Do(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+//Wraps the Doer that sends a request, so every call the Client makes can be logged, measured, traced, cached, failed on
+//purpose or have headers added, e.g.
+//
+//	client.Use(func(next api.Doer) api.Doer {
+//		return api.DoerFunc(func(req *http.Request) (*http.Response, error) {
+//			req.Header.Set("X-Request-Source", "cms")
+//			return next.Do(req)
+//		})
+//	})
+type Middleware func(next Doer) Doer
+
+//Adds middleware to every request the Client sends. The first one added is the outermost. Requests are signed after
+//all of them have run, so anything they change is signed too. A request the API refused because our clock is off is
+//sent through them again, and IsRetry tells them apart
+func (c *Client) Use(middleware ...Middleware) {
+	c.middleware = append(c.middleware, middleware...)
+}
+
+type retryContextKey struct{}
+
+//Reports whether the request is a second attempt, made with CorrectClockSkew after the first was refused
+func IsRetry(req *http.Request) bool {
+	retry, _ := req.Context().Value(retryContextKey{}).(bool)
+	return retry
+}
+
+//Sends a request through the middleware, signing it last. With CorrectClockSkew, a request refused because our clock
+//is off is sent once more, signed with the corrected time
+func (c *Client) do(req *http.Request) (*http.Response, error) {
+	var d Doer = DoerFunc(c.signAndSend)
+	for i := len(c.middleware) - 1; i >= 0; i-- {
+		d = c.middleware[i](d)
+	}
+	if c.CorrectClockSkew {
+		if err := bufferBody(req); err != nil {
+			return nil, err
+		}
+	}
+
+	resp, err := d.Do(req)
+	if err == nil && resp.StatusCode == http.StatusUnauthorized && c.CorrectClockSkew && c.learnClockSkew(resp) {
+		if retry, retryErr := retryRequest(req); retryErr == nil {
+			resp.Body.Close()
+			resp, err = d.Do(retry)
+		}
+	}
+	recordResponse(req, resp, err)
+	recordAudit(req, resp)
+	return resp, err
+}
+
+//Copies a request to send it again, marked so IsRetry reports it
+func retryRequest(req *http.Request) (*http.Request, error) {
+	retry := req.Clone(context.WithValue(req.Context(), retryContextKey{}, true))
+	//Signed again once it has been through the middleware
+	retry.Header.Del("Authorization")
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		retry.Body = body
+	}
+	return retry, nil
+}
+
+func (c *Client) signAndSend(req *http.Request) (*http.Response, error) {
+	_, span := c.startSpan(req.Context(), "sign")
+	err := c.sign(req)
+	endSpan(span, err)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, span := c.tracer().Start(req.Context(), "HTTP "+req.Method, trace.WithSpanKind(trace.SpanKindClient))
+	resp, err := c.Client.Do(req.WithContext(ctx))
+	if err == nil {
+		span.SetAttributes(AttributeStatusCode.Int(resp.StatusCode))
+	}
+	endSpan(span, err)
+	return resp, err
+}
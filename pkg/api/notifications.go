@@ -6,6 +6,7 @@ import (
 	"io/ioutil"
 	"net/http"
 	"fmt"
+	"os"
 	"github.com/pkg/errors"
 	"time"
 )
@@ -47,7 +48,14 @@ type NotificationResponse struct {
 	} `json:"meta"`
 }
 
-func (c *Client) SendNotification(articleId string, alertBody string, countries []string, ignoreWarnings bool) (*NotificationResponse, error) {
+func (c *Client) SendNotification(articleId string, alertBody string, countries []string, ignoreWarnings bool) (_ *NotificationResponse, err error) {
+	ctx, span := c.startSpan(c.context(), "SendNotification", AttributeArticleID.String(articleId))
+	defer span.End()
+	ctx, audit := c.startAudit(ctx, "SendNotification")
+	defer c.finishAudit(audit, &err)
+	audit.ArticleID = articleId
+	audit.Details = map[string]interface{}{"alertBody": alertBody, "countries": countries}
+
 	if !ignoreWarnings {
 		err := validateAlertBodyLength(alertBody)
 		if err != nil {
@@ -55,6 +63,12 @@ func (c *Client) SendNotification(articleId string, alertBody string, countries
 		}
 	}
 
+	if c.NotificationLog != nil {
+		if err := c.NotificationLog.CheckDuplicate(articleId, c.Now()); err != nil {
+			return nil, err
+		}
+	}
+
 	url := fmt.Sprintf("%s/articles/%s/notifications", c.BaseURL, articleId)
 
 	notificationReq := NotificationRequest{
@@ -69,21 +83,15 @@ func (c *Client) SendNotification(articleId string, alertBody string, countries
 		return nil, err
 	}
 
-	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(bodyJsonBytes))
-
-	if err != nil {
-		return nil, err
-	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(bodyJsonBytes))
 
-	auth, err := c.getAuthorization(http.MethodPost, url, "application/json", ioutil.NopCloser(bytes.NewReader(bodyJsonBytes)))
 	if err != nil {
 		return nil, err
 	}
 
-	req.Header.Set("Authorization", auth)
 	req.Header.Set("Content-Type", "application/json")
 
-	resp, err := c.Client.Do(req)
+	resp, err := c.do(req)
 	if err != nil {
 		return nil, err
 	}
@@ -98,6 +106,25 @@ func (c *Client) SendNotification(articleId string, alertBody string, countries
 	if err := json.Unmarshal(b, &notificationResponse); err != nil {
 		return nil, err
 	}
+	audit.Details["notificationId"] = notificationResponse.Data.ID
+
+	if c.NotificationLog != nil {
+		entry := NotificationLogEntry{
+			ArticleID:  articleId,
+			AlertBody:  alertBody,
+			Countries:  countries,
+			ResponseID: notificationResponse.Data.ID,
+			SentAt:     c.Now().UTC(),
+		}
+		//The notification has gone out either way, so failing to record it mustn't look like a failed send
+		if err := c.NotificationLog.Append(entry); err != nil {
+			if c.NotificationLogFailed != nil {
+				c.NotificationLogFailed(entry, err)
+			} else {
+				fmt.Fprintf(os.Stderr, "notification %s for article %s was sent but could not be recorded in the notification log: %s\n", entry.ResponseID, articleId, err)
+			}
+		}
+	}
 
 	return &notificationResponse, nil
 }
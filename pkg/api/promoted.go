@@ -0,0 +1,309 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const snapshotTimeFormat = "20060102T150405.000000000Z"
+
+//The promoted articles of a section at a point in time, as saved to disk by PromotedArticlesManager
+type PromotedArticlesSnapshot struct {
+	ID               string    `json:"id"`
+	SectionID        string    `json:"sectionId"`
+	PromotedArticles []string  `json:"promotedArticles"`
+	TakenAt          time.Time `json:"takenAt"`
+	Operator         string    `json:"operator,omitempty"`
+}
+
+type PromotedArticlesDiff struct {
+	Added   []string `json:"added,omitempty"`
+	Removed []string `json:"removed,omitempty"`
+	Moved   []string `json:"moved,omitempty"`
+}
+
+//Manages the promoted articles of sections on top of PromoteArticles, which always replaces the whole list.
+//Every list that is applied is saved as a snapshot under SnapshotDir so it can be diffed against and restored
+type PromotedArticlesManager struct {
+	Client      *Client
+	SnapshotDir string
+	Operator    string
+}
+
+func NewPromotedArticlesManager(c *Client, snapshotDir string, operator string) *PromotedArticlesManager {
+	return &PromotedArticlesManager{
+		Client:      c,
+		SnapshotDir: snapshotDir,
+		Operator:    operator,
+	}
+}
+
+//Returns the currently promoted articles of the section, as the API reports them. The section is never read from the
+//metadata cache, as promoted articles change far more often than the rest of it. When the API leaves them out of the
+//section this fails rather than falling back to a snapshot, which is stale once anyone else has promoted articles, and
+//changes computed from it would overwrite theirs
+func (m *PromotedArticlesManager) Current(sectionId string) ([]string, error) {
+	ctx, span := m.Client.startSpan(m.Client.context(), "ReadSection", AttributeSectionID.String(sectionId))
+	section, err := m.Client.readSection(ctx, sectionId)
+	span.End()
+	if err != nil {
+		return nil, err
+	}
+	if section.Data.PromotedArticles == nil {
+		return nil, errors.Errorf("the API didn't return the promoted articles of section %s, so the live list is unavailable", sectionId)
+	}
+	return section.Data.PromotedArticles, nil
+}
+
+//Replaces the promoted articles of the section and saves the new list as a snapshot
+func (m *PromotedArticlesManager) Apply(sectionId string, articleIds []string) (*PromoteArticlesResponse, error) {
+	resp, err := m.Client.PromoteArticles(sectionId, articleIds)
+	if err != nil {
+		return nil, err
+	}
+
+	promoted := resp.Data.PromotedArticles
+	if promoted == nil {
+		promoted = articleIds
+	}
+	if _, err := m.SaveSnapshot(sectionId, promoted); err != nil {
+		return resp, errors.Wrap(err, "promoted articles were applied but the snapshot could not be saved")
+	}
+	return resp, nil
+}
+
+//Adds the article at position (0 based). Adding an article that is already promoted moves it to position, and a
+//negative or out of range position appends it
+func (m *PromotedArticlesManager) Add(sectionId string, articleId string, position int) ([]string, error) {
+	current, err := m.Current(sectionId)
+	if err != nil {
+		return nil, err
+	}
+	return AddPromotedArticle(current, articleId, position), nil
+}
+
+func (m *PromotedArticlesManager) Remove(sectionId string, articleId string) ([]string, error) {
+	current, err := m.Current(sectionId)
+	if err != nil {
+		return nil, err
+	}
+	return RemovePromotedArticle(current, articleId), nil
+}
+
+func (m *PromotedArticlesManager) SaveSnapshot(sectionId string, articleIds []string) (*PromotedArticlesSnapshot, error) {
+	if articleIds == nil {
+		articleIds = []string{}
+	}
+	takenAt := m.Client.Now().UTC()
+	snapshot := &PromotedArticlesSnapshot{
+		ID:               takenAt.Format(snapshotTimeFormat),
+		SectionID:        sectionId,
+		PromotedArticles: articleIds,
+		TakenAt:          takenAt,
+		Operator:         m.Operator,
+	}
+
+	b, err := json.MarshalIndent(snapshot, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	dir := m.sectionDir(sectionId)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return snapshot, ioutil.WriteFile(filepath.Join(dir, snapshot.ID+".json"), b, 0644)
+}
+
+//Returns the snapshots of the section, oldest first
+func (m *PromotedArticlesManager) Snapshots(sectionId string) ([]PromotedArticlesSnapshot, error) {
+	files, err := ioutil.ReadDir(m.sectionDir(sectionId))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var snapshots []PromotedArticlesSnapshot
+	for _, f := range files {
+		if f.IsDir() || filepath.Ext(f.Name()) != ".json" {
+			continue
+		}
+		snapshot, err := m.Snapshot(sectionId, strings.TrimSuffix(f.Name(), ".json"))
+		if err != nil {
+			return nil, err
+		}
+		snapshots = append(snapshots, *snapshot)
+	}
+	sort.Slice(snapshots, func(i, j int) bool {
+		return snapshots[i].TakenAt.Before(snapshots[j].TakenAt)
+	})
+	return snapshots, nil
+}
+
+func (m *PromotedArticlesManager) Snapshot(sectionId string, snapshotId string) (*PromotedArticlesSnapshot, error) {
+	b, err := ioutil.ReadFile(filepath.Join(m.sectionDir(sectionId), snapshotId+".json"))
+	if os.IsNotExist(err) {
+		return nil, errors.Errorf("no snapshot %s for section %s", snapshotId, sectionId)
+	}
+	if err != nil {
+		return nil, err
+	}
+	var snapshot PromotedArticlesSnapshot
+	if err := json.Unmarshal(b, &snapshot); err != nil {
+		return nil, errors.Wrapf(err, "reading snapshot %s", snapshotId)
+	}
+	return &snapshot, nil
+}
+
+//Returns the most recent snapshot of the section, or nil if there are none
+func (m *PromotedArticlesManager) LatestSnapshot(sectionId string) (*PromotedArticlesSnapshot, error) {
+	snapshots, err := m.Snapshots(sectionId)
+	if err != nil || len(snapshots) == 0 {
+		return nil, err
+	}
+	return &snapshots[len(snapshots)-1], nil
+}
+
+//Returns the snapshot that was applied before the latest one, which is what an undo would restore
+func (m *PromotedArticlesManager) PreviousSnapshot(sectionId string) (*PromotedArticlesSnapshot, error) {
+	snapshots, err := m.Snapshots(sectionId)
+	if err != nil {
+		return nil, err
+	}
+	if len(snapshots) < 2 {
+		return nil, errors.Errorf("section %s has no previous snapshot to restore", sectionId)
+	}
+	return &snapshots[len(snapshots)-2], nil
+}
+
+//Applies the promoted articles of a snapshot to its section again
+func (m *PromotedArticlesManager) Restore(snapshot *PromotedArticlesSnapshot) (*PromoteArticlesResponse, error) {
+	return m.Apply(snapshot.SectionID, snapshot.PromotedArticles)
+}
+
+func (m *PromotedArticlesManager) sectionDir(sectionId string) string {
+	return filepath.Join(m.SnapshotDir, sectionId)
+}
+
+//Returns a copy of articleIds with articleId at position, moving it there if it is already present
+func AddPromotedArticle(articleIds []string, articleId string, position int) []string {
+	result := RemovePromotedArticle(articleIds, articleId)
+	if position < 0 || position > len(result) {
+		position = len(result)
+	}
+	result = append(result, "")
+	copy(result[position+1:], result[position:])
+	result[position] = articleId
+	return result
+}
+
+//Returns a copy of articleIds without articleId
+func RemovePromotedArticle(articleIds []string, articleId string) []string {
+	result := make([]string, 0, len(articleIds))
+	for _, id := range articleIds {
+		if id != articleId {
+			result = append(result, id)
+		}
+	}
+	return result
+}
+
+//Compares two promoted article lists. Of the articles present in both lists, the ones outside their longest common
+//subsequence are reported as moved
+func DiffPromotedArticles(before []string, after []string) PromotedArticlesDiff {
+	var diff PromotedArticlesDiff
+	inBefore := make(map[string]bool, len(before))
+	inAfter := make(map[string]bool, len(after))
+	for _, id := range before {
+		inBefore[id] = true
+	}
+
+	var keptAfter []string
+	for _, id := range after {
+		inAfter[id] = true
+		if inBefore[id] {
+			keptAfter = append(keptAfter, id)
+		} else {
+			diff.Added = append(diff.Added, id)
+		}
+	}
+
+	var keptBefore []string
+	for _, id := range before {
+		if inAfter[id] {
+			keptBefore = append(keptBefore, id)
+		} else {
+			diff.Removed = append(diff.Removed, id)
+		}
+	}
+
+	unmoved := longestCommonSubsequence(keptBefore, keptAfter)
+	for _, id := range keptAfter {
+		if !unmoved[id] {
+			diff.Moved = append(diff.Moved, id)
+		}
+	}
+	return diff
+}
+
+func longestCommonSubsequence(a []string, b []string) map[string]bool {
+	lengths := make([][]int, len(a)+1)
+	for i := range lengths {
+		lengths[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lengths[i][j] = lengths[i+1][j+1] + 1
+			} else if lengths[i+1][j] >= lengths[i][j+1] {
+				lengths[i][j] = lengths[i+1][j]
+			} else {
+				lengths[i][j] = lengths[i][j+1]
+			}
+		}
+	}
+
+	common := make(map[string]bool)
+	for i, j := 0, 0; i < len(a) && j < len(b); {
+		if a[i] == b[j] {
+			common[a[i]] = true
+			i++
+			j++
+		} else if lengths[i+1][j] >= lengths[i][j+1] {
+			i++
+		} else {
+			j++
+		}
+	}
+	return common
+}
+
+func (d PromotedArticlesDiff) IsEmpty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Moved) == 0
+}
+
+func (d PromotedArticlesDiff) String() string {
+	if d.IsEmpty() {
+		return "no changes"
+	}
+	var b strings.Builder
+	for _, id := range d.Added {
+		fmt.Fprintf(&b, "+ %s\n", id)
+	}
+	for _, id := range d.Removed {
+		fmt.Fprintf(&b, "- %s\n", id)
+	}
+	for _, id := range d.Moved {
+		fmt.Fprintf(&b, "~ %s\n", id)
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
@@ -0,0 +1,311 @@
+package api
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+//The largest request body the proxy forwards, comfortably above the size of a bundle the API accepts
+const maxProxyBodyBytes = 100 << 20
+
+//An API operation a proxy client can be allowed, named after the Client method that calls it. "*" stands for an ID
+type proxyOperation struct {
+	name   string
+	method string
+	path   []string
+}
+
+var proxyOperations = []proxyOperation{
+	{"ReadChannel", http.MethodGet, []string{"channels", "*"}},
+	{"ListSections", http.MethodGet, []string{"channels", "*", "sections"}},
+	{"SearchArticles", http.MethodGet, []string{"channels", "*", "articles"}},
+	{"CreateArticle", http.MethodPost, []string{"channels", "*", "articles"}},
+	{"ReadSection", http.MethodGet, []string{"sections", "*"}},
+	{"PromoteArticles", http.MethodPost, []string{"sections", "*", "promotedArticles"}},
+	{"ReadArticle", http.MethodGet, []string{"articles", "*"}},
+	{"UpdateArticle", http.MethodPost, []string{"articles", "*"}},
+	{"DeleteArticle", http.MethodDelete, []string{"articles", "*"}},
+	{"SendNotification", http.MethodPost, []string{"articles", "*", "notifications"}},
+}
+
+//Names the API operation a request calls, such as ReadArticle, or returns "" when it isn't one
+func ProxyOperation(method string, path string) string {
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	for _, op := range proxyOperations {
+		if op.method != method || len(op.path) != len(parts) {
+			continue
+		}
+		matched := true
+		for i, p := range op.path {
+			if p != "*" && p != parts[i] || len(parts[i]) == 0 {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return op.name
+		}
+	}
+	return ""
+}
+
+//A service allowed to call the API through a SigningProxy
+type ProxyClient struct {
+	Name string `json:"name"`
+	//Sent by the service as a bearer token in the Authorization header
+	Token string `json:"token"`
+	//The operations the service may call, such as ReadArticle or SendNotification. "*" allows all of them
+	Allow []string `json:"allow"`
+}
+
+func (pc *ProxyClient) allows(operation string) bool {
+	for _, allowed := range pc.Allow {
+		if allowed == "*" || allowed == operation {
+			return true
+		}
+	}
+	return false
+}
+
+type ProxyConfig struct {
+	Clients []ProxyClient `json:"clients"`
+}
+
+func LoadProxyConfig(path string) (*ProxyConfig, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var config ProxyConfig
+	if err := json.Unmarshal(b, &config); err != nil {
+		return nil, errors.Wrap(err, path)
+	}
+	for i, pc := range config.Clients {
+		if len(pc.Name) == 0 || len(pc.Token) == 0 {
+			return nil, errors.Errorf("%s: client %d needs a name and a token", path, i+1)
+		}
+	}
+	return &config, nil
+}
+
+//A call made through a SigningProxy, forwarded or refused
+type ProxyAuditEntry struct {
+	Time          time.Time `json:"time"`
+	Client        string    `json:"client,omitempty"`
+	RemoteAddr    string    `json:"remoteAddr"`
+	Operation     string    `json:"operation,omitempty"`
+	Method        string    `json:"method"`
+	Path          string    `json:"path"`
+	Status        int       `json:"status"`
+	RequestBytes  int       `json:"requestBytes"`
+	ResponseBytes int       `json:"responseBytes"`
+	LatencyMs     int64     `json:"latencyMs"`
+	Error         string    `json:"error,omitempty"`
+}
+
+//Forwards requests from internal services to the API, signed with the Client's credentials, so the services never
+//hold the channel secret. Services authenticate with their own token, may only call the operations they are allowed,
+//and only on the Client's channel when it has one. Every call, refused ones included, is passed to Audit, and the
+//ones that change the channel are recorded in the Client's Audit sink too, with the service as the operator
+type SigningProxy struct {
+	Client  *Client
+	Clients []ProxyClient
+	Audit   func(ProxyAuditEntry)
+}
+
+func NewSigningProxy(c *Client, clients []ProxyClient) *SigningProxy {
+	return &SigningProxy{Client: c, Clients: clients}
+}
+
+func (p *SigningProxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	entry := ProxyAuditEntry{
+		Time:       start.UTC(),
+		RemoteAddr: r.RemoteAddr,
+		Method:     r.Method,
+		Path:       r.URL.Path,
+		Operation:  ProxyOperation(r.Method, r.URL.Path),
+	}
+	var body []byte
+	defer func() {
+		entry.LatencyMs = time.Since(start).Milliseconds()
+		if p.Audit != nil {
+			p.Audit(entry)
+		}
+		if p.Client.Audit != nil && r.Method != http.MethodGet && len(entry.Client) > 0 && len(entry.Operation) > 0 {
+			p.recordChange(r, entry, body)
+		}
+	}()
+
+	refuse := func(status int, code string, reason string) {
+		entry.Status = status
+		entry.Error = reason
+		writeProxyError(w, status, code, reason)
+	}
+
+	//The path is classified decoded but sent on as written, so one that decodes differently, such as with %2F, or that
+	//the API could resolve differently, with dot segments, might reach another operation than the one allowed
+	if len(r.URL.RawPath) > 0 || hasDotSegment(r.URL.Path) {
+		refuse(http.StatusBadRequest, "BAD_REQUEST", "the path must not contain escaped characters or dot segments")
+		return
+	}
+
+	client := p.authenticate(r)
+	if client == nil {
+		refuse(http.StatusUnauthorized, "UNAUTHORIZED", "missing or unknown proxy token")
+		return
+	}
+	entry.Client = client.Name
+	if len(entry.Operation) == 0 {
+		refuse(http.StatusNotFound, "NOT_FOUND", fmt.Sprintf("%s %s isn't an API operation", r.Method, r.URL.Path))
+		return
+	}
+	if !client.allows(entry.Operation) {
+		refuse(http.StatusForbidden, "FORBIDDEN", fmt.Sprintf("%s isn't allowed to call %s", client.Name, entry.Operation))
+		return
+	}
+	if channel := pathChannel(r.URL.Path); len(channel) > 0 && len(p.Client.ChannelID) > 0 && channel != p.Client.ChannelID {
+		refuse(http.StatusForbidden, "FORBIDDEN", "only channel "+p.Client.ChannelID+" can be used through this proxy")
+		return
+	}
+
+	var err error
+	body, err = ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxProxyBodyBytes))
+	if err != nil {
+		refuse(http.StatusRequestEntityTooLarge, "REQUEST_TOO_LARGE", err.Error())
+		return
+	}
+	entry.RequestBytes = len(body)
+
+	out, err := http.NewRequestWithContext(r.Context(), r.Method, strings.TrimSuffix(p.Client.BaseURL, "/")+forwardedURI(r.URL), bytes.NewReader(body))
+	if err != nil {
+		refuse(http.StatusBadRequest, "BAD_REQUEST", err.Error())
+		return
+	}
+	for _, h := range []string{"Content-Type", "Accept", "Accept-Language"} {
+		if v := r.Header.Get(h); len(v) > 0 {
+			out.Header.Set(h, v)
+		}
+	}
+
+	resp, err := p.Client.do(out)
+	if err != nil {
+		refuse(http.StatusBadGateway, "BAD_GATEWAY", err.Error())
+		return
+	}
+	defer resp.Body.Close()
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		refuse(http.StatusBadGateway, "BAD_GATEWAY", err.Error())
+		return
+	}
+
+	for name, values := range resp.Header {
+		switch http.CanonicalHeaderKey(name) {
+		case "Connection", "Transfer-Encoding", "Content-Length", "Keep-Alive":
+			continue
+		}
+		w.Header()[name] = values
+	}
+	w.WriteHeader(resp.StatusCode)
+	w.Write(respBody)
+	entry.Status = resp.StatusCode
+	entry.ResponseBytes = len(respBody)
+}
+
+//Records a call that changes the channel in the Client's Audit sink. Failing to is only reported in the proxy's own
+//audit, as the call has been answered by now
+func (p *SigningProxy) recordChange(r *http.Request, call ProxyAuditEntry, body []byte) {
+	entry := AuditEntry{
+		Time:      call.Time,
+		Operator:  call.Client,
+		Host:      hostname(),
+		Channel:   p.Client.ChannelID,
+		Operation: call.Operation,
+		Status:    call.Status,
+		Result:    AuditResultOK,
+		Error:     call.Error,
+		Details:   map[string]interface{}{"via": "proxy", "remoteAddr": call.RemoteAddr},
+	}
+	if call.Status >= 300 || len(call.Error) > 0 {
+		entry.Result = AuditResultFailed
+	}
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	switch parts[0] {
+	case "articles":
+		entry.ArticleID = parts[1]
+	case "sections":
+		entry.SectionID = parts[1]
+	}
+	if len(body) > 0 {
+		sum := sha256.Sum256(body)
+		entry.PayloadSha256 = hex.EncodeToString(sum[:])
+	}
+	if err := p.Client.Audit.Record(entry); err != nil && p.Audit != nil {
+		call.Error = "couldn't record the change in the audit log: " + err.Error()
+		p.Audit(call)
+	}
+}
+
+//Finds the client whose token the request carries. Every token is compared, in constant time, so timing doesn't
+//reveal which ones are close
+func (p *SigningProxy) authenticate(r *http.Request) *ProxyClient {
+	header := r.Header.Get("Authorization")
+	if !strings.HasPrefix(header, "Bearer ") {
+		return nil
+	}
+	token := []byte(strings.TrimPrefix(header, "Bearer "))
+	var found *ProxyClient
+	for i := range p.Clients {
+		if subtle.ConstantTimeCompare(token, []byte(p.Clients[i].Token)) == 1 && found == nil {
+			found = &p.Clients[i]
+		}
+	}
+	return found
+}
+
+func hasDotSegment(path string) bool {
+	for _, part := range strings.Split(path, "/") {
+		if part == "." || part == ".." {
+			return true
+		}
+	}
+	return false
+}
+
+//The path the operation was classified by, escaped the standard way, and the query
+func forwardedURI(u *url.URL) string {
+	uri := (&url.URL{Path: u.Path}).EscapedPath()
+	if len(u.RawQuery) > 0 {
+		uri += "?" + u.RawQuery
+	}
+	return uri
+}
+
+func pathChannel(path string) string {
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	if len(parts) >= 2 && parts[0] == "channels" {
+		return parts[1]
+	}
+	return ""
+}
+
+//Answers with an error shaped like the API's own, so services can handle both the same way
+func writeProxyError(w http.ResponseWriter, status int, code string, message string) {
+	w.Header().Set("Content-Type", string(ContentTypeJson))
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"errors": []map[string]string{{"code": code, "message": message}},
+	})
+}
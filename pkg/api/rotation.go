@@ -0,0 +1,228 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+//An article that is promoted in a section until ExpiresAt
+type PromotionEntry struct {
+	SectionID string    `json:"sectionId"`
+	ArticleID string    `json:"articleId"`
+	AddedAt   time.Time `json:"addedAt"`
+	ExpiresAt time.Time `json:"expiresAt"`
+	Operator  string    `json:"operator,omitempty"`
+}
+
+//The outcome of rotating the promoted articles of one section
+type RotationResult struct {
+	SectionID        string           `json:"sectionId"`
+	Expired          []PromotionEntry `json:"expired"`
+	PromotedArticles []string         `json:"promotedArticles"`
+	Error            string           `json:"error,omitempty"`
+}
+
+//Drops time-boxed promotions from their sections once they expire. The entries are persisted as JSON at Path so
+//that any process calling Tick, such as a long running daemon or a cron job, sees the same promotions
+type PromotionRotation struct {
+	Manager *PromotedArticlesManager
+	Path    string
+
+	mu sync.Mutex
+}
+
+func NewPromotionRotation(m *PromotedArticlesManager, path string) *PromotionRotation {
+	return &PromotionRotation{
+		Manager: m,
+		Path:    path,
+	}
+}
+
+//Applies articleIds as the promoted articles of the section, and drops articleId from them once duration has passed.
+//The list is taken as is, e.g. from Add or AddPromotedArticle, so what is applied is exactly what the caller showed or
+//confirmed, rather than being recomputed from a section that may have changed since
+func (r *PromotionRotation) Promote(sectionId string, articleIds []string, articleId string, duration time.Duration) (*PromoteArticlesResponse, error) {
+	resp, err := r.Manager.Apply(sectionId, articleIds)
+	if err != nil {
+		return nil, err
+	}
+	now := r.Manager.Client.Now().UTC()
+	return resp, r.Record(PromotionEntry{
+		SectionID: sectionId,
+		ArticleID: articleId,
+		AddedAt:   now,
+		ExpiresAt: now.Add(duration),
+	})
+}
+
+//Records an article that has already been promoted so it is dropped once it expires. Recording an article again
+//replaces its previous expiry
+func (r *PromotionRotation) Record(entry PromotionEntry) error {
+	if len(entry.Operator) == 0 {
+		entry.Operator = r.Manager.Operator
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	entries, err := r.readEntries()
+	if err != nil {
+		return err
+	}
+	entries = append(withoutEntry(entries, entry.SectionID, entry.ArticleID), entry)
+	return r.writeEntries(entries)
+}
+
+//Stops tracking the expiry of an article, e.g. because it was removed from the section by hand
+func (r *PromotionRotation) Forget(sectionId string, articleId string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	entries, err := r.readEntries()
+	if err != nil {
+		return err
+	}
+	return r.writeEntries(withoutEntry(entries, sectionId, articleId))
+}
+
+//Returns the tracked promotions ordered by expiry
+func (r *PromotionRotation) Entries() ([]PromotionEntry, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.readEntries()
+}
+
+//Removes every promotion that expired as of now from its section and pushes the recomputed promoted list. Sections
+//that fail keep their entries so the next tick retries them
+func (r *PromotionRotation) Tick(now time.Time) ([]RotationResult, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	entries, err := r.readEntries()
+	if err != nil {
+		return nil, err
+	}
+
+	expiredBySection := make(map[string][]PromotionEntry)
+	var sectionIds []string
+	for _, e := range entries {
+		if e.ExpiresAt.After(now) {
+			continue
+		}
+		if _, ok := expiredBySection[e.SectionID]; !ok {
+			sectionIds = append(sectionIds, e.SectionID)
+		}
+		expiredBySection[e.SectionID] = append(expiredBySection[e.SectionID], e)
+	}
+
+	var results []RotationResult
+	for _, sectionId := range sectionIds {
+		expired := expiredBySection[sectionId]
+		result := RotationResult{SectionID: sectionId, Expired: expired}
+
+		promoted, err := r.rotateSection(sectionId, expired)
+		if err != nil {
+			result.Error = err.Error()
+			results = append(results, result)
+			continue
+		}
+		result.PromotedArticles = promoted
+		results = append(results, result)
+
+		for _, e := range expired {
+			entries = withoutEntry(entries, e.SectionID, e.ArticleID)
+		}
+	}
+
+	return results, r.writeEntries(entries)
+}
+
+//Calls Tick every interval until the context is done. Each round's results are passed to onTick when it isn't nil
+func (r *PromotionRotation) Run(ctx context.Context, interval time.Duration, onTick func([]RotationResult, error)) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		results, err := r.Tick(r.Manager.Client.Now())
+		if onTick != nil {
+			onTick(results, err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+func (r *PromotionRotation) rotateSection(sectionId string, expired []PromotionEntry) ([]string, error) {
+	current, err := r.Manager.Current(sectionId)
+	if err != nil {
+		return nil, err
+	}
+
+	promoted := current
+	for _, e := range expired {
+		promoted = RemovePromotedArticle(promoted, e.ArticleID)
+	}
+	if len(promoted) == len(current) {
+		return current, nil
+	}
+
+	if _, err := r.Manager.Apply(sectionId, promoted); err != nil {
+		return nil, err
+	}
+	return promoted, nil
+}
+
+func (r *PromotionRotation) readEntries() ([]PromotionEntry, error) {
+	b, err := ioutil.ReadFile(r.Path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var entries []PromotionEntry
+	return entries, json.Unmarshal(b, &entries)
+}
+
+func (r *PromotionRotation) writeEntries(entries []PromotionEntry) error {
+	if entries == nil {
+		entries = []PromotionEntry{}
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].ExpiresAt.Before(entries[j].ExpiresAt)
+	})
+	b, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(r.Path), 0755); err != nil {
+		return err
+	}
+
+	//Write to a temporary file first so a crash never leaves a truncated file behind
+	tmp := r.Path + ".tmp"
+	if err := ioutil.WriteFile(tmp, b, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, r.Path)
+}
+
+func withoutEntry(entries []PromotionEntry, sectionId string, articleId string) []PromotionEntry {
+	result := make([]PromotionEntry, 0, len(entries))
+	for _, e := range entries {
+		if e.SectionID != sectionId || e.ArticleID != articleId {
+			result = append(result, e)
+		}
+	}
+	return result
+}
@@ -1,7 +1,6 @@
 package api
 
 import (
-	"bytes"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
@@ -37,26 +36,29 @@ type SearchResponseMeta struct {
 	NextPageToken string `json:"nextPageToken,omitempty"`
 }
 
+//An article as search lists it
+type SearchArticle struct {
+	CreatedAt               time.Time     `json:"createdAt"`
+	ModifiedAt              time.Time     `json:"modifiedAt"`
+	ID                      string        `json:"id"`
+	Type                    string        `json:"type"`
+	ShareURL                string        `json:"shareUrl"`
+	Links                   Links         `json:"links"`
+	Revision                string        `json:"revision"`
+	State                   string        `json:"state"`
+	AccessoryText           string        `json:"accessoryText"`
+	Title                   string        `json:"title"`
+	MaturityRating          string        `json:"maturityRating"`
+	Warnings                []interface{} `json:"warnings"`
+	IsCandidateToBeFeatured bool          `json:"isCandidateToBeFeatured"`
+	IsSponsored             bool          `json:"isSponsored"`
+	IsPreview               bool          `json:"isPreview"`
+	IsDevelopingStory       bool          `json:"isDevelopingStory"`
+	IsHidden                bool          `json:"isHidden"`
+}
+
 type SearchArticlesResponse struct {
-	Data []struct {
-		CreatedAt               time.Time     `json:"createdAt"`
-		ModifiedAt              time.Time     `json:"modifiedAt"`
-		ID                      string        `json:"id"`
-		Type                    string        `json:"type"`
-		ShareURL                string        `json:"shareUrl"`
-		Links                   Links         `json:"links"`
-		Revision                string        `json:"revision"`
-		State                   string        `json:"state"`
-		AccessoryText           string        `json:"accessoryText"`
-		Title                   string        `json:"title"`
-		MaturityRating          string        `json:"maturityRating"`
-		Warnings                []interface{} `json:"warnings"`
-		IsCandidateToBeFeatured bool          `json:"isCandidateToBeFeatured"`
-		IsSponsored             bool          `json:"isSponsored"`
-		IsPreview               bool          `json:"isPreview"`
-		IsDevelopingStory       bool          `json:"isDevelopingStory"`
-		IsHidden                bool          `json:"isHidden"`
-	} `json:"data"`
+	Data  []SearchArticle    `json:"data"`
 	Links Links              `json:"links,omitempty"`
 	Meta  SearchResponseMeta `json:"meta,omitempty"`
 }
@@ -86,8 +88,11 @@ func (options *SearchArticlesOptions) ApplyToQuery(query *url.Values) {
 }
 
 func (c *Client) SearchArticles(options *SearchArticlesOptions) (*SearchArticlesResponse, error) {
+	ctx, span := c.startSpan(c.context(), "SearchArticles", AttributeChannelID.String(c.ChannelID))
+	defer span.End()
+
 	url := fmt.Sprintf("%s/channels/%s/articles", c.BaseURL, c.ChannelID)
-	req, err := http.NewRequest(http.MethodGet, url, nil)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -98,15 +103,7 @@ func (c *Client) SearchArticles(options *SearchArticlesOptions) (*SearchArticles
 
 	req.URL.RawQuery = query.Encode()
 
-	auth, err := c.getAuthorization(http.MethodGet, req.URL.String(), "", ioutil.NopCloser(bytes.NewReader([]byte{})))
-	if err != nil {
-		return nil, err
-	}
-	req.Header.Set("Authorization", auth)
-
-	client := c.Client
-
-	resp, err := client.Do(req)
+	resp, err := c.do(req)
 	if err != nil {
 		return nil, err
 	}
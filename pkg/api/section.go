@@ -1,11 +1,13 @@
 package api
 
 import (
-	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/pkg/errors"
@@ -21,6 +23,8 @@ type ReadSectionResponse struct {
 		Links      Links     `json:"links"`
 		Name       string    `json:"name"`
 		IsDefault  bool      `json:"isDefault"`
+		//Only present when the API reports the promoted articles of the section
+		PromotedArticles []string `json:"promotedArticles,omitempty"`
 	} `json:"data"`
 }
 
@@ -38,21 +42,33 @@ type ListSectionsResponse struct {
 }
 
 func (c *Client) ReadSection(sectionId string) (*ReadSectionResponse, error) {
-	url := fmt.Sprintf("%s/sections/%s", c.BaseURL, sectionId)
-	req, err := http.NewRequest(http.MethodGet, url, nil)
+	ctx, span := c.startSpan(c.context(), "ReadSection", AttributeSectionID.String(sectionId))
+	defer span.End()
+
+	if c.MetadataCache == nil {
+		return c.readSection(ctx, sectionId)
+	}
+
+	var cached ReadSectionResponse
+	if c.MetadataCache.get(sectionCacheKey(sectionId), &cached) {
+		return &cached, nil
+	}
+	resp, err := c.readSection(ctx, sectionId)
 	if err != nil {
 		return nil, err
 	}
+	_ = c.MetadataCache.put(sectionCacheKey(sectionId), resp)
+	return resp, nil
+}
 
-	auth, err := c.getAuthorization(http.MethodGet, url, "", ioutil.NopCloser(bytes.NewReader([]byte{})))
+func (c *Client) readSection(ctx context.Context, sectionId string) (*ReadSectionResponse, error) {
+	url := fmt.Sprintf("%s/sections/%s", c.BaseURL, sectionId)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
 	if err != nil {
 		return nil, err
 	}
-	req.Header.Set("Authorization", auth)
-
-	client := c.Client
 
-	resp, err := client.Do(req)
+	resp, err := c.do(req)
 	if err != nil {
 		return nil, err
 	}
@@ -74,21 +90,33 @@ func (c *Client) ReadSection(sectionId string) (*ReadSectionResponse, error) {
 }
 
 func (c *Client) ListSections() (*ListSectionsResponse, error) {
-	url := fmt.Sprintf("%s/channels/%s/sections", c.BaseURL, c.ChannelID)
-	req, err := http.NewRequest(http.MethodGet, url, nil)
+	ctx, span := c.startSpan(c.context(), "ListSections", AttributeChannelID.String(c.ChannelID))
+	defer span.End()
+
+	if c.MetadataCache == nil {
+		return c.listSections(ctx)
+	}
+
+	var cached ListSectionsResponse
+	if c.MetadataCache.get(sectionsCacheKey(c.ChannelID), &cached) {
+		return &cached, nil
+	}
+	resp, err := c.listSections(ctx)
 	if err != nil {
 		return nil, err
 	}
+	_ = c.MetadataCache.put(sectionsCacheKey(c.ChannelID), resp)
+	return resp, nil
+}
 
-	auth, err := c.getAuthorization(http.MethodGet, url, "", ioutil.NopCloser(bytes.NewReader([]byte{})))
+func (c *Client) listSections(ctx context.Context) (*ListSectionsResponse, error) {
+	url := fmt.Sprintf("%s/channels/%s/sections", c.BaseURL, c.ChannelID)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
 	if err != nil {
 		return nil, err
 	}
-	req.Header.Set("Authorization", auth)
 
-	client := c.Client
-
-	resp, err := client.Do(req)
+	resp, err := c.do(req)
 	if err != nil {
 		return nil, err
 	}
@@ -105,3 +133,83 @@ func (c *Client) ListSections() (*ListSectionsResponse, error) {
 	return &listSectionsResp, err
 
 }
+
+//Resolves section references to the section links expected by Metadata.Data.Links.Sections. A reference can be a
+//section link, a section ID or a section name (case insensitive), and comma separated references are split. The
+//sections of the channel are listed once and cached on the client, see ForgetSections
+func (c *Client) ResolveSections(refs []string) ([]string, error) {
+	var links []string
+	seen := make(map[string]bool)
+	for _, ref := range splitSectionRefs(refs) {
+		link, err := c.resolveSection(ref)
+		if err != nil {
+			return nil, err
+		}
+		if !seen[link] {
+			seen[link] = true
+			links = append(links, link)
+		}
+	}
+	return links, nil
+}
+
+//Drops the cached sections so the next ResolveSections lists them again
+func (c *Client) ForgetSections() error {
+	c.sectionsMu.Lock()
+	defer c.sectionsMu.Unlock()
+	c.sections = nil
+	if c.MetadataCache != nil {
+		return c.MetadataCache.InvalidateSections(c.ChannelID)
+	}
+	return nil
+}
+
+func (c *Client) resolveSection(ref string) (string, error) {
+	if strings.HasPrefix(ref, "http://") || strings.HasPrefix(ref, "https://") {
+		return ref, nil
+	}
+
+	sections, err := c.cachedSections()
+	if err != nil {
+		return "", err
+	}
+
+	var names []string
+	for _, s := range sections.Data {
+		if s.ID == ref || strings.EqualFold(s.Name, ref) {
+			if len(s.Links.Self) > 0 {
+				return s.Links.Self, nil
+			}
+			return fmt.Sprintf("%s/sections/%s", c.BaseURL, s.ID), nil
+		}
+		names = append(names, s.Name)
+	}
+	sort.Strings(names)
+	return "", errors.Errorf("no section named %q in channel %s. Sections are: %s", ref, c.ChannelID, strings.Join(names, ", "))
+}
+
+func (c *Client) cachedSections() (*ListSectionsResponse, error) {
+	c.sectionsMu.Lock()
+	defer c.sectionsMu.Unlock()
+	if c.sections != nil {
+		return c.sections, nil
+	}
+	sections, err := c.ListSections()
+	if err != nil {
+		return nil, err
+	}
+	c.sections = sections
+	return sections, nil
+}
+
+func splitSectionRefs(refs []string) []string {
+	var split []string
+	for _, ref := range refs {
+		for _, r := range strings.Split(ref, ",") {
+			if r = strings.TrimSpace(r); len(r) > 0 {
+				split = append(split, r)
+			}
+		}
+	}
+	return split
+}
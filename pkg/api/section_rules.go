@@ -0,0 +1,85 @@
+package api
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+//Maps CMS categories and tags to Apple News sections. A rule matches an article when any of its categories or tags
+//match (case insensitive), and Sections may be anything ResolveSections accepts
+type SectionRule struct {
+	Categories []string `json:"categories,omitempty"`
+	Tags       []string `json:"tags,omitempty"`
+	Sections   []string `json:"sections"`
+}
+
+//A rules file looks like
+//	{"rules": [{"categories": ["sport"], "tags": ["football"], "sections": ["Sports"]}], "default": ["Top Stories"]}
+//Default is meant for new articles that no rule matches and that weren't given any sections otherwise
+type SectionRules struct {
+	Rules   []SectionRule `json:"rules"`
+	Default []string      `json:"default,omitempty"`
+}
+
+func LoadSectionRules(path string) (*SectionRules, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var rules SectionRules
+	if err := json.Unmarshal(b, &rules); err != nil {
+		return nil, errors.Wrapf(err, "parsing section rules %s", path)
+	}
+	for i, r := range rules.Rules {
+		if len(r.Sections) == 0 {
+			return nil, errors.Errorf("section rule %d in %s has no sections", i+1, path)
+		}
+	}
+	return &rules, nil
+}
+
+//Returns the sections of every rule matching the categories or tags, in rule order and without duplicates. Default is
+//not included
+func (r *SectionRules) Sections(categories []string, tags []string) []string {
+	var sections []string
+	seen := make(map[string]bool)
+	for _, rule := range r.Rules {
+		if !containsFold(rule.Categories, categories) && !containsFold(rule.Tags, tags) {
+			continue
+		}
+		for _, s := range rule.Sections {
+			if !seen[s] {
+				seen[s] = true
+				sections = append(sections, s)
+			}
+		}
+	}
+	return sections
+}
+
+//Returns the keywords from the metadata of an article.json, which is where CMS tags usually end up
+func ArticleKeywords(articleJson []byte) ([]string, error) {
+	var article struct {
+		Metadata struct {
+			Keywords []string `json:"keywords"`
+		} `json:"metadata"`
+	}
+	if err := json.Unmarshal(articleJson, &article); err != nil {
+		return nil, err
+	}
+	return article.Metadata.Keywords, nil
+}
+
+func containsFold(candidates []string, values []string) bool {
+	for _, c := range candidates {
+		for _, v := range values {
+			if strings.EqualFold(strings.TrimSpace(c), strings.TrimSpace(v)) {
+				return true
+			}
+		}
+	}
+	return false
+}
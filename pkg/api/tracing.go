@@ -0,0 +1,118 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "github.com/sdotz/apple-news-push-api/pkg/api"
+
+//Span attributes set on the spans of Client methods
+const (
+	AttributeArticleID   = attribute.Key("apple_news.article_id")
+	AttributeChannelID   = attribute.Key("apple_news.channel_id")
+	AttributeSectionID   = attribute.Key("apple_news.section_id")
+	AttributeUploadBytes = attribute.Key("apple_news.upload_bytes")
+	AttributeStatusCode  = attribute.Key("http.response.status_code")
+	AttributeErrorCode   = attribute.Key("apple_news.error_code")
+)
+
+//Returns a copy of the Client whose calls are made with ctx, so their spans are children of the span in ctx and their
+//requests are cancelled with it. The copy keeps its own list of sections for resolving section names
+func (c *Client) WithContext(ctx context.Context) *Client {
+	copied := &Client{
+		Client:                c.Client,
+		APIKey:                c.APIKey,
+		APISecret:             c.APISecret,
+		BaseURL:               c.BaseURL,
+		ChannelID:             c.ChannelID,
+		NotificationLog:       c.NotificationLog,
+		NotificationLogFailed: c.NotificationLogFailed,
+		MetadataCache:         c.MetadataCache,
+		ImageProcessor:        c.ImageProcessor,
+		TracerProvider:        c.TracerProvider,
+		Clock:                 c.Clock,
+		CorrectClockSkew:      c.CorrectClockSkew,
+		Audit:                 c.Audit,
+		Operator:              c.Operator,
+		AuditFailed:           c.AuditFailed,
+		middleware:            c.middleware,
+		ctx:                   ctx,
+	}
+	copied.clockSkew.Store(c.clockSkew.Load())
+	return copied
+}
+
+func (c *Client) context() context.Context {
+	if c.ctx == nil {
+		return context.Background()
+	}
+	return c.ctx
+}
+
+func (c *Client) tracer() trace.Tracer {
+	provider := c.TracerProvider
+	if provider == nil {
+		provider = otel.GetTracerProvider()
+	}
+	return provider.Tracer(tracerName)
+}
+
+//Starts the span of a Client method, or of a step of one when ctx already has a span
+func (c *Client) startSpan(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return c.tracer().Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+//Ends the span of a step, marking it as failed when err isn't nil
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+//Records what came of a request on the span of the method that sent it: the bytes uploaded, the status, and for
+//failures, the error code from the response
+func recordResponse(req *http.Request, resp *http.Response, err error) {
+	span := trace.SpanFromContext(req.Context())
+	if !span.IsRecording() {
+		return
+	}
+	if req.ContentLength > 0 {
+		span.SetAttributes(AttributeUploadBytes.Int64(req.ContentLength))
+	}
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return
+	}
+	span.SetAttributes(AttributeStatusCode.Int(resp.StatusCode))
+	if resp.StatusCode < 400 {
+		return
+	}
+
+	body, readErr := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+	description := strconv.Itoa(resp.StatusCode)
+	var errorResponse struct {
+		Errors []struct {
+			Code string `json:"code"`
+		} `json:"errors"`
+	}
+	if readErr == nil && json.Unmarshal(body, &errorResponse) == nil && len(errorResponse.Errors) > 0 {
+		span.SetAttributes(AttributeErrorCode.String(errorResponse.Errors[0].Code))
+		description = errorResponse.Errors[0].Code
+	}
+	span.SetStatus(codes.Error, description)
+}
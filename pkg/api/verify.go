@@ -0,0 +1,116 @@
+package api
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+//How far the date of a signature may be from now when VerifyAuthorization is given no limit
+const DefaultMaxSignatureSkew = 5 * time.Minute
+
+//Why a request's Authorization header was refused, as opposed to the secret lookup failing
+type AuthorizationError struct {
+	Reason string
+}
+
+func (e *AuthorizationError) Error() string {
+	return "invalid authorization: " + e.Reason
+}
+
+//The parts of an HHMAC Authorization header
+type hhmacAuthorization struct {
+	key, signature, date string
+}
+
+func parseAuthorization(header string) (*hhmacAuthorization, error) {
+	if !strings.HasPrefix(header, "HHMAC;") {
+		return nil, &AuthorizationError{Reason: "not an HHMAC Authorization header"}
+	}
+	auth := &hhmacAuthorization{}
+	for _, field := range strings.Split(strings.TrimPrefix(header, "HHMAC;"), ";") {
+		kv := strings.SplitN(strings.TrimSpace(field), "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		switch kv[0] {
+		case "key":
+			auth.key = kv[1]
+		case "signature":
+			auth.signature = kv[1]
+		case "date":
+			auth.date = kv[1]
+		}
+	}
+	if len(auth.key) == 0 || len(auth.signature) == 0 || len(auth.date) == 0 {
+		return nil, &AuthorizationError{Reason: "the Authorization header needs a key, signature and date"}
+	}
+	return auth, nil
+}
+
+//Checks the HHMAC Authorization header of a request the way the API does, returning the API key it was signed for.
+//The signature is recomputed over the method, the URL the request was sent to, the date, the content type and the
+//body, with the secret lookupSecret returns for the key, and its date must be within maxSkew of now. The body is left
+//for the handler to read. Refused requests give an *AuthorizationError, anything else comes from lookupSecret
+func VerifyAuthorization(r *http.Request, lookupSecret func(key string) (string, error), maxSkew time.Duration) (string, error) {
+	auth, err := parseAuthorization(r.Header.Get("Authorization"))
+	if err != nil {
+		return "", err
+	}
+
+	at, err := time.Parse(time.RFC3339, auth.date)
+	if err != nil {
+		return "", &AuthorizationError{Reason: "the date isn't an RFC 3339 time"}
+	}
+	if maxSkew <= 0 {
+		maxSkew = DefaultMaxSignatureSkew
+	}
+	if skew := time.Since(at); skew > maxSkew || skew < -maxSkew {
+		return "", &AuthorizationError{Reason: "the signature is dated " + auth.date + ", too far from now"}
+	}
+
+	secret, err := lookupSecret(auth.key)
+	if err != nil {
+		return "", err
+	}
+
+	body := []byte{}
+	if r.Body != nil && r.Body != http.NoBody {
+		if body, err = ioutil.ReadAll(r.Body); err != nil {
+			return "", errors.Wrap(err, "reading the request body")
+		}
+		r.Body.Close()
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
+	}
+
+	signer := &Client{APIKey: auth.key, APISecret: secret}
+	expected, err := signer.signWithDate(r.Method, requestURL(r), r.Header.Get("Content-Type"), body, auth.date)
+	if err != nil {
+		return "", errors.Wrap(err, "the secret of "+auth.key)
+	}
+	expectedAuth, _ := parseAuthorization(expected)
+	if !hmac.Equal([]byte(expectedAuth.signature), []byte(auth.signature)) {
+		return "", &AuthorizationError{Reason: "the signature doesn't match"}
+	}
+	return auth.key, nil
+}
+
+//Rebuilds the absolute URL a client sent a request to, which is what it signed
+func requestURL(r *http.Request) string {
+	if r.URL.IsAbs() {
+		return r.URL.String()
+	}
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	if proto := r.Header.Get("X-Forwarded-Proto"); len(proto) > 0 {
+		scheme = proto
+	}
+	return scheme + "://" + r.Host + r.URL.RequestURI()
+}
@@ -0,0 +1,264 @@
+//Package ingest turns the items of RSS and Atom feeds into Apple News articles
+package ingest
+
+import (
+	"bytes"
+	"encoding/xml"
+	"html"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+type Feed struct {
+	Title string
+	Items []Item
+}
+
+//A feed item, normalized from either RSS or Atom
+type Item struct {
+	GUID       string
+	Title      string
+	Link       string
+	Author     string
+	Categories []string
+	//The HTML body of the item, falling back to its summary when the feed has no full content
+	Content   string
+	Published time.Time
+	Updated   time.Time
+}
+
+type rssFeed struct {
+	Channel struct {
+		Title string    `xml:"title"`
+		Items []rssItem `xml:"item"`
+	} `xml:"channel"`
+}
+
+type rssItem struct {
+	GUID        string   `xml:"guid"`
+	Title       string   `xml:"title"`
+	Link        string   `xml:"link"`
+	Author      string   `xml:"author"`
+	Creator     string   `xml:"http://purl.org/dc/elements/1.1/ creator"`
+	Categories  []string `xml:"category"`
+	Description string   `xml:"description"`
+	Encoded     string   `xml:"http://purl.org/rss/1.0/modules/content/ encoded"`
+	PubDate     string   `xml:"pubDate"`
+}
+
+type atomFeed struct {
+	Title   string      `xml:"title"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomEntry struct {
+	ID    string `xml:"id"`
+	Title string `xml:"title"`
+	Links []struct {
+		Href string `xml:"href,attr"`
+		Rel  string `xml:"rel,attr"`
+	} `xml:"link"`
+	Authors []struct {
+		Name string `xml:"name"`
+	} `xml:"author"`
+	Categories []struct {
+		Term string `xml:"term,attr"`
+	} `xml:"category"`
+	Content   atomText `xml:"content"`
+	Summary   atomText `xml:"summary"`
+	Published string   `xml:"published"`
+	Updated   string   `xml:"updated"`
+}
+
+//Atom text constructs hold escaped markup when their type is html, and the markup itself when it is xhtml
+type atomText struct {
+	Type  string `xml:"type,attr"`
+	Text  string `xml:",chardata"`
+	Inner string `xml:",innerxml"`
+}
+
+func (t atomText) html() string {
+	switch t.Type {
+	case "xhtml":
+		return t.Inner
+	case "html":
+		return t.Text
+	default:
+		return html.EscapeString(t.Text)
+	}
+}
+
+var rssDateFormats = []string{
+	time.RFC1123Z,
+	time.RFC1123,
+	"Mon, 2 Jan 2006 15:04:05 -0700",
+	"Mon, 2 Jan 2006 15:04:05 MST",
+	"2 Jan 2006 15:04:05 -0700",
+	time.RFC3339,
+}
+
+//Reads a feed from a local file or from an http(s) URL
+func LoadFeed(source string, client *http.Client) (*Feed, error) {
+	if !strings.HasPrefix(source, "http://") && !strings.HasPrefix(source, "https://") {
+		f, err := os.Open(source)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		return ParseFeed(f)
+	}
+
+	resp, err := client.Get(source)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("%s returned a %d", source, resp.StatusCode)
+	}
+	return ParseFeed(resp.Body)
+}
+
+//Parses an RSS 2.0 or Atom feed, telling them apart by their root element
+func ParseFeed(r io.Reader) (*Feed, error) {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	root, err := rootElement(b)
+	if err != nil {
+		return nil, err
+	}
+	switch root {
+	case "rss":
+		var rss rssFeed
+		if err := newDecoder(b).Decode(&rss); err != nil {
+			return nil, errors.Wrap(err, "parsing RSS feed")
+		}
+		return rss.feed(), nil
+	case "feed":
+		var atom atomFeed
+		if err := newDecoder(b).Decode(&atom); err != nil {
+			return nil, errors.Wrap(err, "parsing Atom feed")
+		}
+		return atom.feed(), nil
+	default:
+		return nil, errors.Errorf("unsupported feed with root element <%s>, expected RSS or Atom", root)
+	}
+}
+
+func (rss *rssFeed) feed() *Feed {
+	feed := &Feed{Title: strings.TrimSpace(rss.Channel.Title)}
+	for _, i := range rss.Channel.Items {
+		item := Item{
+			GUID:       strings.TrimSpace(i.GUID),
+			Title:      strings.TrimSpace(i.Title),
+			Link:       strings.TrimSpace(i.Link),
+			Author:     strings.TrimSpace(i.Creator),
+			Categories: trimAll(i.Categories),
+			Content:    i.Encoded,
+			Published:  parseDate(i.PubDate, rssDateFormats),
+		}
+		if len(item.GUID) == 0 {
+			item.GUID = item.Link
+		}
+		if len(item.Author) == 0 {
+			item.Author = strings.TrimSpace(i.Author)
+		}
+		if len(strings.TrimSpace(item.Content)) == 0 {
+			item.Content = i.Description
+		}
+		item.Updated = item.Published
+		feed.Items = append(feed.Items, item)
+	}
+	return feed
+}
+
+func (atom *atomFeed) feed() *Feed {
+	feed := &Feed{Title: strings.TrimSpace(atom.Title)}
+	for _, e := range atom.Entries {
+		item := Item{
+			GUID:      strings.TrimSpace(e.ID),
+			Title:     strings.TrimSpace(e.Title),
+			Content:   e.Content.html(),
+			Published: parseDate(e.Published, []string{time.RFC3339}),
+			Updated:   parseDate(e.Updated, []string{time.RFC3339}),
+		}
+		for _, l := range e.Links {
+			if l.Rel == "" || l.Rel == "alternate" {
+				item.Link = l.Href
+				break
+			}
+		}
+		if len(e.Authors) > 0 {
+			item.Author = strings.TrimSpace(e.Authors[0].Name)
+		}
+		for _, c := range e.Categories {
+			item.Categories = append(item.Categories, strings.TrimSpace(c.Term))
+		}
+		if len(item.GUID) == 0 {
+			item.GUID = item.Link
+		}
+		if len(strings.TrimSpace(item.Content)) == 0 {
+			item.Content = e.Summary.html()
+		}
+		if item.Published.IsZero() {
+			item.Published = item.Updated
+		}
+		feed.Items = append(feed.Items, item)
+	}
+	return feed
+}
+
+func rootElement(b []byte) (string, error) {
+	d := newDecoder(b)
+	for {
+		t, err := d.Token()
+		if err != nil {
+			return "", errors.Wrap(err, "reading feed")
+		}
+		if start, ok := t.(xml.StartElement); ok {
+			return start.Name.Local, nil
+		}
+	}
+}
+
+func newDecoder(b []byte) *xml.Decoder {
+	d := xml.NewDecoder(bytes.NewReader(b))
+	d.Strict = false
+	d.CharsetReader = func(charset string, input io.Reader) (io.Reader, error) {
+		switch strings.ToLower(charset) {
+		case "utf-8", "utf8", "us-ascii", "ascii":
+			return input, nil
+		}
+		return nil, errors.Errorf("unsupported feed encoding %s, only UTF-8 feeds can be ingested", charset)
+	}
+	return d
+}
+
+func parseDate(s string, formats []string) time.Time {
+	s = strings.TrimSpace(s)
+	for _, f := range formats {
+		if t, err := time.Parse(f, s); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+func trimAll(values []string) []string {
+	var trimmed []string
+	for _, v := range values {
+		if v = strings.TrimSpace(v); len(v) > 0 {
+			trimmed = append(trimmed, v)
+		}
+	}
+	return trimmed
+}
@@ -0,0 +1,269 @@
+package ingest
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"html"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sdotz/apple-news-push-api/pkg/anf"
+	"github.com/sdotz/apple-news-push-api/pkg/api"
+)
+
+const (
+	ActionCreated   = "created"
+	ActionUpdated   = "updated"
+	ActionUnchanged = "unchanged"
+	ActionFailed    = "failed"
+)
+
+//What was last ingested for a feed item
+type ItemState struct {
+	ArticleID   string    `json:"articleId"`
+	ContentHash string    `json:"contentHash"`
+	IngestedAt  time.Time `json:"ingestedAt"`
+}
+
+type Result struct {
+	GUID      string   `json:"guid"`
+	Title     string   `json:"title"`
+	Action    string   `json:"action"`
+	ArticleID string   `json:"articleId,omitempty"`
+	Error     string   `json:"error,omitempty"`
+	Dropped   []string `json:"dropped,omitempty"`
+}
+
+//Upserts feed items into the channel of Client. Every item is converted into a bundle under BundleDir, created as a
+//new article the first time its GUID is seen and updated afterwards, but only when its content hash changed. What was
+//ingested is kept in the JSON file at StatePath, keyed by GUID
+type Ingester struct {
+	Client    *api.Client
+	StatePath string
+	BundleDir string
+	//Applied to every article. Its sections are combined with those SectionRules match for the item's categories
+	Metadata     api.Metadata
+	SectionRules *api.SectionRules
+	//The directory relative image paths in item content are resolved against
+	BaseDir string
+	//The URL the feed was fetched from, if it was. Relative image paths are then resolved against the item's link, or
+	//this when the item has none, and never read from BaseDir
+	BaseURL string
+	//Only convert the items and report what would happen
+	DryRun bool
+}
+
+//Ingests every item of the feed. Failing items are reported in their result and don't stop the others
+func (i *Ingester) Ingest(feed *Feed) ([]Result, error) {
+	state, err := i.readState()
+	if err != nil {
+		return nil, err
+	}
+
+	var results []Result
+	for _, item := range feed.Items {
+		result := i.ingestItem(item, state)
+		results = append(results, result)
+		if result.Action == ActionCreated || result.Action == ActionUpdated {
+			//Saved after every item so a failure halfway through doesn't create duplicates on the next run
+			if err := i.writeState(state); err != nil {
+				return results, err
+			}
+		}
+	}
+	return results, nil
+}
+
+func (i *Ingester) ingestItem(item Item, state map[string]ItemState) Result {
+	result := Result{GUID: item.GUID, Title: item.Title}
+	fail := func(err error) Result {
+		result.Action = ActionFailed
+		result.Error = err.Error()
+		return result
+	}
+
+	if len(item.GUID) == 0 {
+		return fail(errors.Errorf("item %q has neither a GUID nor a link", item.Title))
+	}
+
+	hash := ContentHash(item)
+	previous, seen := state[item.GUID]
+	result.ArticleID = previous.ArticleID
+	if seen && previous.ContentHash == hash {
+		result.Action = ActionUnchanged
+		return result
+	}
+
+	bundlePath, conversion, err := i.writeBundle(item)
+	if err != nil {
+		return fail(err)
+	}
+	result.Dropped = conversion.Dropped
+
+	result.Action = ActionCreated
+	if seen {
+		result.Action = ActionUpdated
+	}
+	if i.DryRun {
+		return result
+	}
+
+	bundle, err := api.NewDirBundle(bundlePath)
+	if err != nil {
+		return fail(err)
+	}
+	metadata, err := i.metadata(item, !seen)
+	if err != nil {
+		return fail(err)
+	}
+
+	var resp *api.ReadArticleResponse
+	if seen {
+		//The stored revision may be stale if the article was edited elsewhere, so always update the latest one
+		var current *api.ReadArticleResponse
+		current, err = i.Client.ReadArticle(previous.ArticleID)
+		if err != nil {
+			return fail(err)
+		}
+		resp, err = i.Client.UpdateArticleBundle(previous.ArticleID, current.Data.Revision, bundle, metadata)
+	} else {
+		resp, err = i.Client.CreateArticleBundle(bundle, metadata)
+	}
+	if err != nil {
+		return fail(err)
+	}
+
+	result.ArticleID = resp.Data.ID
+	state[item.GUID] = ItemState{
+		ArticleID:   resp.Data.ID,
+		ContentHash: hash,
+		IngestedAt:  i.Client.Now().UTC(),
+	}
+	return result
+}
+
+//Converts the item and writes it as a bundle named after its GUID
+func (i *Ingester) writeBundle(item Item) (string, *anf.Conversion, error) {
+	conversion, err := anf.ConvertHtml(strings.NewReader(item.Content), anf.HtmlOptions{
+		Identifier: itemIdentifier(item.GUID),
+		Title:      item.Title,
+		BaseDir:    i.BaseDir,
+		BaseURL:    i.itemBaseURL(item),
+	})
+	if err != nil {
+		return "", nil, err
+	}
+
+	doc := conversion.Document
+	header := []anf.Component{{Role: anf.RoleTitle, Text: html.EscapeString(item.Title), Format: anf.FormatHtml}}
+	doc.Metadata = &anf.Metadata{CanonicalURL: item.Link}
+	if len(item.Author) > 0 {
+		doc.Metadata.Authors = []string{item.Author}
+		header = append(header, anf.Component{Role: anf.RoleByline, Text: "By " + item.Author})
+	}
+	doc.Components = append(header, doc.Components...)
+	if !item.Published.IsZero() {
+		doc.Metadata.DatePublished = item.Published.UTC().Format(time.RFC3339)
+	}
+	if !item.Updated.IsZero() {
+		doc.Metadata.DateModified = item.Updated.UTC().Format(time.RFC3339)
+	}
+	doc.Metadata.Keywords = item.Categories
+
+	bundlePath := filepath.Join(i.BundleDir, doc.Identifier)
+	return bundlePath, conversion, conversion.WriteBundle(bundlePath)
+}
+
+//The longest part of an item identifier taken from the slug of its GUID
+const maxIdentifierSlug = 60
+
+//Names the bundle and identifies the document of an item. The slug of the GUID is followed by a short hash of it, as
+//slugs lose case and punctuation, and GUIDs such as https://x.com/?p=12 and https://x.com/p-12 would share one
+func itemIdentifier(guid string) string {
+	slug := anf.Slug(guid)
+	if len(slug) > maxIdentifierSlug {
+		slug = strings.TrimRight(slug[:maxIdentifierSlug], "-")
+	}
+	sum := sha256.Sum256([]byte(guid))
+	return slug + "-" + hex.EncodeToString(sum[:])[:8]
+}
+
+//The page an item's relative image paths are relative to: its link, which may itself be relative to the feed
+func (i *Ingester) itemBaseURL(item Item) string {
+	if len(i.BaseURL) == 0 {
+		return ""
+	}
+	base, err := url.Parse(i.BaseURL)
+	if err != nil {
+		return i.BaseURL
+	}
+	link, err := url.Parse(item.Link)
+	if err != nil || len(item.Link) == 0 {
+		return i.BaseURL
+	}
+	return base.ResolveReference(link).String()
+}
+
+//The default sections of the rules are only used for new articles, so an update never moves an article into them
+func (i *Ingester) metadata(item Item, creating bool) (*api.Metadata, error) {
+	metadata := i.Metadata
+	sections := append([]string{}, metadata.Data.Links.Sections...)
+	if i.SectionRules != nil {
+		matched := i.SectionRules.Sections(item.Categories, nil)
+		if creating && len(matched) == 0 && len(sections) == 0 {
+			matched = i.SectionRules.Default
+		}
+		sections = append(sections, matched...)
+	}
+	if len(sections) > 0 {
+		resolved, err := i.Client.ResolveSections(sections)
+		if err != nil {
+			return nil, err
+		}
+		metadata.Data.Links.Sections = resolved
+	}
+	return &metadata, nil
+}
+
+//Hashes everything about an item that ends up in its article, so unchanged items can be skipped
+func ContentHash(item Item) string {
+	h := sha256.New()
+	for _, part := range []string{item.Title, item.Link, item.Author, item.Content, strings.Join(item.Categories, ",")} {
+		h.Write([]byte(part))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func (i *Ingester) readState() (map[string]ItemState, error) {
+	state := make(map[string]ItemState)
+	b, err := ioutil.ReadFile(i.StatePath)
+	if os.IsNotExist(err) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return state, json.Unmarshal(b, &state)
+}
+
+func (i *Ingester) writeState(state map[string]ItemState) error {
+	b, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(i.StatePath), 0755); err != nil {
+		return err
+	}
+	tmp := i.StatePath + ".tmp"
+	if err := ioutil.WriteFile(tmp, b, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, i.StatePath)
+}
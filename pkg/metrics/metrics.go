@@ -0,0 +1,307 @@
+package metrics
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sdotz/apple-news-push-api/pkg/api"
+)
+
+//Latency histogram buckets in seconds, from quick reads to slow bundle uploads
+var DefaultBuckets = []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60}
+
+//Path segments followed by an ID, which is replaced so each endpoint is one label value however many articles there are
+var idSegments = map[string]string{"articles": "{articleId}", "channels": "{channelId}", "sections": "{sectionId}"}
+
+//Collects metrics about the calls a Client makes and serves them in the Prometheus text format. Add Middleware to the
+//clients to measure and mount the Metrics itself, an http.Handler, wherever Prometheus scrapes, e.g. /metrics
+type Metrics struct {
+	//Upper bounds of the latency histogram buckets, in seconds. Changing them after the first request has no effect
+	Buckets []float64
+
+	mu          sync.Mutex
+	buckets     []float64
+	requests    map[requestLabels]float64
+	errors      map[endpointLabels]float64
+	latency     map[endpointLabels]*histogram
+	uploadBytes map[endpointLabels]float64
+	retries     map[endpointLabels]float64
+	throttled   map[endpointLabels]float64
+	gauges      map[string]float64
+}
+
+type endpointLabels struct {
+	method, endpoint string
+}
+
+type requestLabels struct {
+	endpointLabels
+	status int
+}
+
+type histogram struct {
+	bounds []float64
+	counts []float64
+	sum    float64
+	count  float64
+}
+
+func New() *Metrics {
+	return &Metrics{
+		Buckets:     DefaultBuckets,
+		requests:    make(map[requestLabels]float64),
+		errors:      make(map[endpointLabels]float64),
+		latency:     make(map[endpointLabels]*histogram),
+		uploadBytes: make(map[endpointLabels]float64),
+		retries:     make(map[endpointLabels]float64),
+		throttled:   make(map[endpointLabels]float64),
+		gauges:      make(map[string]float64),
+	}
+}
+
+//Turns a request path into the endpoint it calls, e.g. /articles/{articleId}/notifications
+func Endpoint(p string) string {
+	parts := strings.Split(strings.Trim(p, "/"), "/")
+	for i := 0; i+1 < len(parts); i++ {
+		if placeholder, ok := idSegments[parts[i]]; ok {
+			parts[i+1] = placeholder
+			i++
+		}
+	}
+	return "/" + strings.Join(parts, "/")
+}
+
+//Measures every request sent through it. Throttling info and the notification quota are read from the responses
+func (m *Metrics) Middleware() api.Middleware {
+	return func(next api.Doer) api.Doer {
+		return api.DoerFunc(func(req *http.Request) (*http.Response, error) {
+			labels := endpointLabels{method: req.Method, endpoint: Endpoint(req.URL.Path)}
+			if api.IsRetry(req) {
+				m.add(m.retries, labels, 1)
+			}
+			if req.ContentLength > 0 {
+				m.add(m.uploadBytes, labels, float64(req.ContentLength))
+			}
+
+			start := time.Now()
+			resp, err := next.Do(req)
+			latency := time.Since(start)
+			if err != nil {
+				m.add(m.errors, labels, 1)
+				m.observeLatency(labels, latency)
+				return resp, err
+			}
+
+			body, err := ioutil.ReadAll(resp.Body)
+			resp.Body.Close()
+			resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+			m.observeLatency(labels, latency)
+			m.mu.Lock()
+			m.requests[requestLabels{labels, resp.StatusCode}]++
+			m.mu.Unlock()
+			if err != nil {
+				return resp, err
+			}
+			m.observeResponse(labels, resp.StatusCode, body)
+			return resp, nil
+		})
+	}
+}
+
+//Counts a request that is sent again after failing, for middleware or callers that retry themselves. Retries the
+//Client makes after correcting clock skew are counted by Middleware
+func (m *Metrics) ObserveRetry(method, path string) {
+	m.add(m.retries, endpointLabels{method: method, endpoint: Endpoint(path)}, 1)
+}
+
+//Records the daily notification quota a SendNotification response reports
+func (m *Metrics) ObserveNotification(resp *api.NotificationResponse) {
+	daily := resp.Meta.Quotas.Daily
+	if daily.Limit == 0 && daily.Sent == 0 {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.gauges["notifications_sent"] = float64(daily.Sent)
+	m.gauges["notifications_limit"] = float64(daily.Limit)
+	m.gauges["notifications_remaining"] = float64(daily.Limit - daily.Sent)
+}
+
+func (m *Metrics) observeResponse(labels endpointLabels, status int, body []byte) {
+	var meta struct {
+		Meta api.Meta `json:"meta"`
+	}
+	json.Unmarshal(body, &meta)
+	t := meta.Meta.Throttling
+	if t.IsThrottled || status == http.StatusTooManyRequests {
+		m.add(m.throttled, labels, 1)
+	}
+	if t != (api.Meta{}).Throttling {
+		m.mu.Lock()
+		m.gauges["quota_available"] = float64(t.QuotaAvailable)
+		m.gauges["queue_size"] = float64(t.QueueSize)
+		m.gauges["estimated_delay_seconds"] = float64(t.EstimatedDelayInSeconds)
+		m.mu.Unlock()
+	}
+
+	if labels.method == http.MethodPost && strings.HasSuffix(labels.endpoint, "/notifications") && status < 300 {
+		var notification api.NotificationResponse
+		if json.Unmarshal(body, &notification) == nil {
+			m.ObserveNotification(&notification)
+		}
+	}
+}
+
+func (m *Metrics) add(counter map[endpointLabels]float64, labels endpointLabels, v float64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	counter[labels] += v
+}
+
+func (m *Metrics) observeLatency(labels endpointLabels, latency time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	//Frozen on first use, so every histogram has the buckets it was counted in
+	if m.buckets == nil {
+		m.buckets = append([]float64{}, m.Buckets...)
+	}
+	h, ok := m.latency[labels]
+	if !ok {
+		h = &histogram{bounds: m.buckets, counts: make([]float64, len(m.buckets))}
+		m.latency[labels] = h
+	}
+	seconds := latency.Seconds()
+	for i, bound := range h.bounds {
+		if seconds <= bound {
+			h.counts[i]++
+		}
+	}
+	h.sum += seconds
+	h.count++
+}
+
+var gaugeHelp = map[string]string{
+	"quota_available":         "The publishing quota left, as last reported by the API",
+	"queue_size":              "The number of requests queued by the API, as last reported",
+	"estimated_delay_seconds": "The delay before queued requests are processed, as last reported by the API",
+	"notifications_sent":      "Notifications sent today, as last reported by the API",
+	"notifications_limit":     "The daily notification quota",
+	"notifications_remaining": "Notifications that can still be sent today",
+}
+
+//Writes the metrics in the Prometheus text exposition format
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	m.WriteTo(w)
+}
+
+func (m *Metrics) WriteTo(w io.Writer) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var b bytes.Buffer
+	header(&b, "apple_news_requests_total", "counter", "Requests sent to the API by endpoint and response status")
+	keys := make([]requestLabels, 0, len(m.requests))
+	for k := range m.requests {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].endpointLabels != keys[j].endpointLabels {
+			return keys[i].endpointLabels.less(keys[j].endpointLabels)
+		}
+		return keys[i].status < keys[j].status
+	})
+	for _, k := range keys {
+		fmt.Fprintf(&b, "apple_news_requests_total{%s,status=\"%d\"} %s\n", k.endpointLabels, k.status, value(m.requests[k]))
+	}
+
+	writeCounter(&b, "apple_news_request_errors_total", "Requests that failed without a response", m.errors)
+	writeCounter(&b, "apple_news_upload_bytes_total", "Bytes of request bodies sent, such as bundle uploads", m.uploadBytes)
+	writeCounter(&b, "apple_news_retries_total", "Requests sent again after failing", m.retries)
+	writeCounter(&b, "apple_news_throttled_total", "Responses saying the request was throttled", m.throttled)
+
+	header(&b, "apple_news_request_duration_seconds", "histogram", "How long requests to the API took")
+	for _, k := range sortedLabels(m.latency) {
+		h := m.latency[k]
+		for i, bound := range h.bounds {
+			fmt.Fprintf(&b, "apple_news_request_duration_seconds_bucket{%s,le=\"%s\"} %s\n", k, value(bound), value(h.counts[i]))
+		}
+		fmt.Fprintf(&b, "apple_news_request_duration_seconds_bucket{%s,le=\"+Inf\"} %s\n", k, value(h.count))
+		fmt.Fprintf(&b, "apple_news_request_duration_seconds_sum{%s} %s\n", k, value(h.sum))
+		fmt.Fprintf(&b, "apple_news_request_duration_seconds_count{%s} %s\n", k, value(h.count))
+	}
+
+	names := make([]string, 0, len(m.gauges))
+	for name := range m.gauges {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		header(&b, "apple_news_"+name, "gauge", gaugeHelp[name])
+		fmt.Fprintf(&b, "apple_news_%s %s\n", name, value(m.gauges[name]))
+	}
+	return b.WriteTo(w)
+}
+
+func writeCounter(b *bytes.Buffer, name, help string, counter map[endpointLabels]float64) {
+	header(b, name, "counter", help)
+	for _, k := range sortedLabels(counter) {
+		fmt.Fprintf(b, "%s{%s} %s\n", name, k, value(counter[k]))
+	}
+}
+
+func header(b *bytes.Buffer, name, kind, help string) {
+	fmt.Fprintf(b, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+func sortedLabels(m interface{}) []endpointLabels {
+	var keys []endpointLabels
+	switch m := m.(type) {
+	case map[endpointLabels]float64:
+		for k := range m {
+			keys = append(keys, k)
+		}
+	case map[endpointLabels]*histogram:
+		for k := range m {
+			keys = append(keys, k)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].less(keys[j])
+	})
+	return keys
+}
+
+func (l endpointLabels) less(o endpointLabels) bool {
+	if l.endpoint != o.endpoint {
+		return l.endpoint < o.endpoint
+	}
+	return l.method < o.method
+}
+
+func (l endpointLabels) String() string {
+	return fmt.Sprintf("method=%s,endpoint=%s", quote(l.method), quote(l.endpoint))
+}
+
+func quote(s string) string {
+	s = strings.Replace(s, `\`, `\\`, -1)
+	s = strings.Replace(s, "\n", `\n`, -1)
+	return `"` + strings.Replace(s, `"`, `\"`, -1) + `"`
+}
+
+func value(v float64) string {
+	if math.IsInf(v, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}